@@ -2,17 +2,35 @@ package main
 
 import (
 	"app/internal/application"
+	"app/internal/config"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
 )
 
 func main() {
-	cfg := &application.ConfigServerChi{
-		ServerAddress:  ":8080",
-		LoaderFilePath: "docs/db/products.json",
+	cfg, opts, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		config.Usage(os.Stdout)
+		return
 	}
-	app := application.NewServerChi(cfg)
-	if err := app.Run(); err != nil {
-		fmt.Println(err)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if opts.PrintConfig {
+		if err := config.Write(os.Stdout, cfg.Redacted()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		return
 	}
+
+	app := application.NewServerChi(cfg.ServerChi())
+	if err := app.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -1,26 +1,117 @@
 package application
 
 import (
+	"app/internal"
+	"app/internal/certs"
 	"app/internal/handler"
+	"app/internal/health"
 	"app/internal/loader"
+	"app/internal/logging"
+	"app/internal/metrics"
 	"app/internal/middlewares"
+	"app/internal/problem"
 	"app/internal/repository"
 	"app/internal/service"
+	"app/internal/token"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	StorageMemory  = "memory"
+	StorageFile    = "file"
+	StorageJournal = "journal"
 )
 
 type ConfigServerChi struct {
-	ServerAddress  string
+	ServerAddress string
+	// LoaderFilePath is the catalog, read and written as CSV when it ends in
+	// .csv and as JSON otherwise.
 	LoaderFilePath string
+	// StorageBackend selects the repository: StorageMemory keeps changes in
+	// memory only, StorageFile writes them back to LoaderFilePath and
+	// StorageJournal appends them to JournalPath, compacting into
+	// LoaderFilePath.
+	StorageBackend string
+	// FlushInterval batches file writes; zero saves on every write.
+	FlushInterval time.Duration
+	// JournalPath defaults to LoaderFilePath with a ".journal" suffix.
+	JournalPath string
+	// CompactEvery is the number of journal records that triggers a compaction.
+	CompactEvery int
+	// APIKeys and the keys read from APIKeysFile are accepted on /products.
+	// Run fails without any unless ClientCerts or JWTSecret is set.
+	APIKeys     []middlewares.APIKey
+	APIKeysFile string
+	// JWTSecret enables HS256 bearer tokens and the admin-only
+	// POST /auth/tokens endpoint minting them. JWTIssuer, JWTAudience and
+	// JWTTTL default to the token package defaults.
+	JWTSecret   string
+	JWTIssuer   string
+	JWTAudience string
+	JWTTTL      time.Duration
+	// ReadRateLimit and WriteRateLimit throttle each client and
+	// AuthFailureRateLimit the failed authentications of each remote IP;
+	// zero values keep the middlewares defaults and a negative rate disables
+	// a limit.
+	ReadRateLimit        middlewares.Limit
+	WriteRateLimit       middlewares.Limit
+	AuthFailureRateLimit middlewares.Limit
+	// LogLevel is debug, info, warn or error; info by default. Logs are JSON
+	// lines on stdout.
+	LogLevel string
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout, IdleTimeout and
+	// MaxHeaderBytes configure the http.Server; see there.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// ShutdownTimeout bounds how long in-flight requests may drain after
+	// SIGINT or SIGTERM before their connections are closed.
+	ShutdownTimeout time.Duration
+	// TLSCertFile and TLSKeyFile switch the server to HTTPS. The pair is
+	// reloaded when the files change, checked every TLSReloadInterval (30s
+	// by default, negative disables).
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSReloadInterval time.Duration
+	// TLSMinVersion and TLSCipherPolicy default to the certs package
+	// defaults: TLS 1.2 and Go's cipher suites.
+	TLSMinVersion   string
+	TLSCipherPolicy string
+	// TLSClientCAFile enables client certificates verified against the CA
+	// bundle, optional unless TLSClientAuth is "require". ClientCerts maps
+	// their common names to roles on /products.
+	TLSClientCAFile string
+	TLSClientAuth   string
+	ClientCerts     []middlewares.ClientCert
 }
 
 func NewServerChi(cfg *ConfigServerChi) *ServerChi {
 	defaultConfig := &ConfigServerChi{
-		ServerAddress: ":8080",
+		ServerAddress:     ":8080",
+		StorageBackend:    StorageFile,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       time.Minute,
+		MaxHeaderBytes:    1 << 20,
+		ShutdownTimeout:   15 * time.Second,
 	}
 	if cfg != nil {
 		if cfg.ServerAddress != "" {
@@ -29,32 +120,360 @@ func NewServerChi(cfg *ConfigServerChi) *ServerChi {
 		if cfg.LoaderFilePath != "" {
 			defaultConfig.LoaderFilePath = cfg.LoaderFilePath
 		}
+		if cfg.StorageBackend != "" {
+			defaultConfig.StorageBackend = cfg.StorageBackend
+		}
+		if cfg.FlushInterval > 0 {
+			defaultConfig.FlushInterval = cfg.FlushInterval
+		}
+		if cfg.JournalPath != "" {
+			defaultConfig.JournalPath = cfg.JournalPath
+		}
+		if cfg.CompactEvery > 0 {
+			defaultConfig.CompactEvery = cfg.CompactEvery
+		}
+		defaultConfig.APIKeys = cfg.APIKeys
+		defaultConfig.APIKeysFile = cfg.APIKeysFile
+		defaultConfig.JWTSecret = cfg.JWTSecret
+		defaultConfig.JWTIssuer = cfg.JWTIssuer
+		defaultConfig.JWTAudience = cfg.JWTAudience
+		defaultConfig.JWTTTL = cfg.JWTTTL
+		defaultConfig.ReadRateLimit = cfg.ReadRateLimit
+		defaultConfig.WriteRateLimit = cfg.WriteRateLimit
+		defaultConfig.AuthFailureRateLimit = cfg.AuthFailureRateLimit
+		defaultConfig.LogLevel = cfg.LogLevel
+		if cfg.ReadHeaderTimeout > 0 {
+			defaultConfig.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+		}
+		if cfg.ReadTimeout > 0 {
+			defaultConfig.ReadTimeout = cfg.ReadTimeout
+		}
+		if cfg.WriteTimeout > 0 {
+			defaultConfig.WriteTimeout = cfg.WriteTimeout
+		}
+		if cfg.IdleTimeout > 0 {
+			defaultConfig.IdleTimeout = cfg.IdleTimeout
+		}
+		if cfg.MaxHeaderBytes > 0 {
+			defaultConfig.MaxHeaderBytes = cfg.MaxHeaderBytes
+		}
+		if cfg.ShutdownTimeout > 0 {
+			defaultConfig.ShutdownTimeout = cfg.ShutdownTimeout
+		}
+		defaultConfig.TLSCertFile = cfg.TLSCertFile
+		defaultConfig.TLSKeyFile = cfg.TLSKeyFile
+		defaultConfig.TLSReloadInterval = cfg.TLSReloadInterval
+		defaultConfig.TLSMinVersion = cfg.TLSMinVersion
+		defaultConfig.TLSCipherPolicy = cfg.TLSCipherPolicy
+		defaultConfig.TLSClientCAFile = cfg.TLSClientCAFile
+		defaultConfig.TLSClientAuth = cfg.TLSClientAuth
+		defaultConfig.ClientCerts = cfg.ClientCerts
+	}
+	if defaultConfig.JournalPath == "" && defaultConfig.LoaderFilePath != "" {
+		defaultConfig.JournalPath = defaultConfig.LoaderFilePath + ".journal"
 	}
 
 	return &ServerChi{
 		serverAddress:  defaultConfig.ServerAddress,
 		loaderFilePath: defaultConfig.LoaderFilePath,
+		storageBackend: defaultConfig.StorageBackend,
+		flushInterval:  defaultConfig.FlushInterval,
+		journalPath:    defaultConfig.JournalPath,
+		compactEvery:   defaultConfig.CompactEvery,
+		apiKeys:        defaultConfig.APIKeys,
+		apiKeysFile:    defaultConfig.APIKeysFile,
+		jwt: token.ConfigHS256{
+			Secret:   []byte(defaultConfig.JWTSecret),
+			Issuer:   defaultConfig.JWTIssuer,
+			Audience: defaultConfig.JWTAudience,
+			TTL:      defaultConfig.JWTTTL,
+		},
+		rateLimits: middlewares.ConfigRateLimiter{
+			Read:         defaultConfig.ReadRateLimit,
+			Write:        defaultConfig.WriteRateLimit,
+			AuthFailures: defaultConfig.AuthFailureRateLimit,
+		},
+		logLevel: defaultConfig.LogLevel,
+		tlsReload: certs.ConfigReloader{
+			CertFile: defaultConfig.TLSCertFile,
+			KeyFile:  defaultConfig.TLSKeyFile,
+			Interval: defaultConfig.TLSReloadInterval,
+		},
+		tls: certs.ConfigServer{
+			MinVersion:   defaultConfig.TLSMinVersion,
+			CipherPolicy: defaultConfig.TLSCipherPolicy,
+			ClientCAFile: defaultConfig.TLSClientCAFile,
+			ClientAuth:   defaultConfig.TLSClientAuth,
+		},
+		clientCerts: defaultConfig.ClientCerts,
+		server: &http.Server{
+			ReadHeaderTimeout: defaultConfig.ReadHeaderTimeout,
+			ReadTimeout:       defaultConfig.ReadTimeout,
+			WriteTimeout:      defaultConfig.WriteTimeout,
+			IdleTimeout:       defaultConfig.IdleTimeout,
+			MaxHeaderBytes:    defaultConfig.MaxHeaderBytes,
+		},
+		shutdownTimeout: defaultConfig.ShutdownTimeout,
+		ready:           make(chan struct{}),
+		stopped:         make(chan struct{}),
 	}
 }
 
 type ServerChi struct {
 	serverAddress  string
 	loaderFilePath string
+	storageBackend string
+	flushInterval  time.Duration
+	journalPath    string
+	compactEvery   int
+	apiKeys        []middlewares.APIKey
+	apiKeysFile    string
+	jwt            token.ConfigHS256
+	rateLimits     middlewares.ConfigRateLimiter
+	logLevel       string
+	tlsReload      certs.ConfigReloader
+	tls            certs.ConfigServer
+	clientCerts    []middlewares.ClientCert
+
+	server          *http.Server
+	shutdownTimeout time.Duration
+
+	// mu guards the fields below, shared by Run and Shutdown.
+	mu           sync.Mutex
+	addr         string
+	hooks        []func(context.Context) error
+	closing      bool
+	shutdownOnce sync.Once
+	shutdownErr  error
+	ready        chan struct{}
+	stopped      chan struct{}
 }
 
+// OnShutdown registers f to run once the server has drained, after the hooks
+// registered later. Run registers the repository's final flush this way.
+// Once Shutdown has begun, f runs right away instead.
+func (a *ServerChi) OnShutdown(f func(ctx context.Context) error) {
+	a.mu.Lock()
+	if !a.closing {
+		a.hooks = append(a.hooks, f)
+		a.mu.Unlock()
+		return
+	}
+	a.mu.Unlock()
+
+	if err := f(context.Background()); err != nil {
+		slog.Error("shutdown hook failed", "error", err)
+	}
+}
+
+// Ready is closed once Run is accepting connections.
+func (a *ServerChi) Ready() <-chan struct{} {
+	return a.ready
+}
+
+// Addr returns the address Run listens on, which tells the port picked for
+// a ServerAddress such as ":0". It is empty until Ready is closed.
+func (a *ServerChi) Addr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.addr
+}
+
+// Shutdown stops accepting connections, waits for in-flight requests until
+// ctx is done, closing the connections still open then, and runs the
+// shutdown hooks. It makes Run return and is safe to call more than once.
+func (a *ServerChi) Shutdown(ctx context.Context) error {
+	a.shutdownOnce.Do(func() {
+		a.mu.Lock()
+		a.closing = true
+		hooks := a.hooks
+		a.mu.Unlock()
+
+		var errs []error
+		if err := a.server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("drain: %w", err))
+			a.server.Close()
+		}
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := hooks[i](ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		a.shutdownErr = errors.Join(errs...)
+		close(a.stopped)
+	})
+
+	<-a.stopped
+	return a.shutdownErr
+}
+
+// Run serves the API until SIGINT, SIGTERM or a call to Shutdown, then drains
+// in-flight requests for up to ShutdownTimeout and flushes the repository.
 func (a *ServerChi) Run() (err error) {
-	ld := loader.NewProductJSONFile(a.loaderFilePath)
+	a.mu.Lock()
+	closing := a.closing
+	a.mu.Unlock()
+	if closing {
+		<-a.stopped
+		return a.shutdownErr
+	}
+
+	h, err := a.setup()
+	if err != nil {
+		a.Shutdown(context.Background())
+		return
+	}
+
+	ln, err := net.Listen("tcp", a.serverAddress)
+	if err != nil {
+		a.Shutdown(context.Background())
+		return
+	}
+
+	a.mu.Lock()
+	if a.closing {
+		a.mu.Unlock()
+		ln.Close()
+		<-a.stopped
+		return a.shutdownErr
+	}
+	a.server.Handler = h
+	a.addr = ln.Addr().String()
+	a.mu.Unlock()
+	close(a.ready)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			slog.Info("shutting down", "signal", sig.String(), "timeout", a.shutdownTimeout.String())
+			ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+			defer cancel()
+			a.Shutdown(ctx)
+		case <-a.stopped:
+		}
+	}()
+
+	if a.server.TLSConfig != nil {
+		slog.Info("listening", "addr", a.addr, "tls", true)
+		err = a.server.ServeTLS(ln, "", "")
+	} else {
+		slog.Info("listening", "addr", a.addr)
+		err = a.server.Serve(ln)
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		a.Shutdown(context.Background())
+		return
+	}
+
+	<-a.stopped
+	if a.shutdownErr != nil {
+		slog.Error("shutdown failed", "error", a.shutdownErr)
+	} else {
+		slog.Info("shut down")
+	}
+	return a.shutdownErr
+}
+
+// setup builds the repository and the router. What needs releasing on
+// shutdown is registered with OnShutdown.
+func (a *ServerChi) setup() (h http.Handler, err error) {
+	level, err := logging.ParseLevel(a.logLevel)
+	if err != nil {
+		return
+	}
+	logger := logging.New(os.Stdout, level)
+	slog.SetDefault(logger)
+
+	auth, err := a.authenticator()
+	if err != nil {
+		return
+	}
+
+	limiter := middlewares.NewRateLimiter(&a.rateLimits)
+	a.OnShutdown(func(context.Context) error { return limiter.Close() })
+
+	var tokens *token.HS256
+	if len(a.jwt.Secret) > 0 {
+		if tokens, err = token.NewHS256(&a.jwt); err != nil {
+			return
+		}
+		auth.AcceptTokens(tokens)
+	}
+
+	if err = a.setupTLS(); err != nil {
+		return
+	}
+
+	ld := catalogFile(a.loaderFilePath)
 	db, err := ld.Load()
 	if err != nil {
 		return
 	}
-	rp := repository.NewProductMap(db)
+
+	live := health.NewRegistry(nil)
+	ready := health.NewRegistry(nil)
+	ready.Register("shutdown", func(context.Context) error {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		if a.closing {
+			return errors.New("shutting down")
+		}
+		return nil
+	})
+
+	var rp internal.ProductRepository
+	switch a.storageBackend {
+	case StorageMemory:
+		rp = repository.NewProductMap(db)
+	case StorageFile:
+		ld.RegisterChecks(ready)
+		cfg := &repository.ConfigProductFile{FlushPolicy: repository.FlushEveryWrite}
+		if a.flushInterval > 0 {
+			cfg.FlushPolicy = repository.FlushPeriodic
+			cfg.FlushInterval = a.flushInterval
+		}
+		fileRp := repository.NewProductFile(db, ld, cfg)
+		a.OnShutdown(func(context.Context) error { return fileRp.Close() })
+		rp = fileRp
+	case StorageJournal:
+		ld.RegisterChecks(ready)
+		journalRp, err := repository.NewProductJournal(db, ld, &repository.ConfigProductJournal{
+			JournalPath:  a.journalPath,
+			CompactEvery: a.compactEvery,
+		})
+		if err != nil {
+			return nil, err
+		}
+		a.OnShutdown(func(context.Context) error { return journalRp.Close() })
+		rp = journalRp
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", a.storageBackend)
+	}
+
+	if c, ok := rp.(health.Checker); ok {
+		c.RegisterChecks(ready)
+	}
+
+	reg := metrics.NewRegistry()
+	rp = repository.NewProductMetrics(rp, reg)
+
 	sv := service.NewProductDefault(rp)
 	hd := handler.NewProductDefault(sv)
 	rt := chi.NewRouter()
 
-	rt.Use(middleware.Logger)
-	rt.Use(middleware.Recoverer)
+	rt.Use(middlewares.RequestID)
+	rt.Use(middlewares.AccessLog(logger))
+	rt.Use(middlewares.NewHTTPMetrics(reg).Instrument)
+	rt.Use(middlewares.Recoverer)
+
+	rt.NotFound(problem.NotFoundHandler)
+	rt.MethodNotAllowed(problem.MethodNotAllowedHandler)
 
 	rt.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -62,18 +481,112 @@ func (a *ServerChi) Run() (err error) {
 		json.NewEncoder(w).Encode(map[string]string{"message": "pong"})
 	})
 
+	// Metrics carry business figures such as the stock value: admins only.
+	rt.With(limiter.LimitAuthFailures, auth.Authenticate, limiter.Limit, middlewares.RequireRole(middlewares.RoleAdmin)).
+		Method(http.MethodGet, "/metrics", reg.Handler())
+	rt.Method(http.MethodGet, "/healthz", live.Handler())
+	rt.Method(http.MethodGet, "/readyz", ready.Handler())
+
+	if tokens != nil {
+		hdAuth := handler.NewAuthDefault(tokens)
+		rt.With(limiter.LimitAuthFailures, auth.Authenticate, limiter.Limit, middlewares.RequireRole(middlewares.RoleAdmin)).
+			Post("/auth/tokens", hdAuth.MintToken())
+	}
+
 	rt.Route("/products", func(rt chi.Router) {
-		rt.Use(middlewares.AuthMiddleware)
-
-		rt.Get("/", hd.GetAll())
-		rt.Post("/", hd.CreateProducts())
-		rt.Get("/search", hd.SearchProducts())
-		rt.Get("/{id_product}", hd.GetProductById())
-		rt.Put("/{id_product}", hd.UpdateProduct())
-		rt.Patch("/{id_product}", hd.UpdateProductAttributes())
-		rt.Delete("/{id_product}", hd.DeleteProduct())
+		rt.Use(limiter.LimitAuthFailures)
+		rt.Use(auth.Authenticate)
+		rt.Use(limiter.Limit)
+
+		rt.Group(func(rt chi.Router) {
+			rt.Use(middlewares.RequireRole(middlewares.RoleReader))
+
+			rt.Get("/", hd.GetAll())
+			rt.Get("/search", hd.SearchProducts())
+			rt.Get("/search/text", hd.SearchProductsText())
+			rt.Get("/code/{code_value}", hd.GetProductByCodeValue())
+			rt.Get("/expiring", hd.GetExpiringProducts())
+			rt.Get("/expired", hd.GetExpiredProducts())
+			rt.Get("/export", hd.ExportProducts())
+			rt.Get("/{id_product}", hd.GetProductById())
+		})
+
+		rt.Group(func(rt chi.Router) {
+			rt.Use(middlewares.RequireRole(middlewares.RoleEditor))
+
+			rt.Post("/", hd.CreateProducts())
+			rt.Post("/import", hd.ImportProducts())
+			rt.Put("/{id_product}", hd.UpdateProduct())
+			rt.Patch("/{id_product}", hd.UpdateProductAttributes())
+			rt.Delete("/{id_product}", hd.DeleteProduct())
+		})
 	})
 
-	err = http.ListenAndServe(a.serverAddress, rt)
-	return
+	return rt, nil
+}
+
+// setupTLS builds the TLS settings when a certificate is configured.
+func (a *ServerChi) setupTLS() error {
+	if a.tlsReload.CertFile == "" && a.tlsReload.KeyFile == "" {
+		if a.tls.ClientCAFile != "" {
+			return errors.New("tls: client certificates need a server certificate")
+		}
+		return nil
+	}
+
+	reloader, err := certs.NewReloader(&a.tlsReload)
+	if err != nil {
+		return err
+	}
+	a.OnShutdown(func(context.Context) error { return reloader.Close() })
+
+	cfg := a.tls
+	cfg.GetCertificate = reloader.GetCertificate
+	tlsConfig, err := certs.NewServerConfig(&cfg)
+	if err != nil {
+		return err
+	}
+	a.server.TLSConfig = tlsConfig
+	return nil
+}
+
+// catalogFile reads and writes the catalog at path, as CSV when its
+// extension is .csv and as JSON otherwise.
+func catalogFile(path string) interface {
+	internal.ProductLoader
+	internal.ProductSaver
+	health.Checker
+} {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return loader.NewProductCSVFile(path, nil)
+	}
+	return loader.NewProductJSONFile(path)
+}
+
+func (a *ServerChi) authenticator() (*middlewares.Authenticator, error) {
+	keys := append([]middlewares.APIKey(nil), a.apiKeys...)
+	if a.apiKeysFile != "" {
+		fileKeys, err := middlewares.LoadAPIKeys(a.apiKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+	if len(keys) == 0 && len(a.clientCerts) == 0 && len(a.jwt.Secret) == 0 {
+		return nil, errors.New("no authentication configured: set API keys, client certs or a JWT secret")
+	}
+
+	auth, err := middlewares.NewAuthenticator(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.clientCerts) > 0 {
+		if a.tls.ClientCAFile == "" {
+			return nil, errors.New("client certs configured without a client CA")
+		}
+		if err = auth.AcceptClientCerts(a.clientCerts); err != nil {
+			return nil, err
+		}
+	}
+	return auth, nil
 }
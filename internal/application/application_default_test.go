@@ -0,0 +1,443 @@
+package application_test
+
+import (
+	"app/internal/application"
+	"app/internal/middlewares"
+	"app/internal/token"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerChi_ShutdownFlushesRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id":1,"name":"Milk","quantity":1,"code_value":"M1","is_published":true,"expiration":"","price":2}]`), 0644))
+
+	app := application.NewServerChi(&application.ConfigServerChi{
+		ServerAddress:  "127.0.0.1:0",
+		LoaderFilePath: path,
+		// Periodic flushing far in the future: only shutdown saves.
+		FlushInterval: time.Hour,
+		APIKeys:       []middlewares.APIKey{{Name: "test", Key: "k", Role: middlewares.RoleEditor}},
+		LogLevel:      "error",
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- app.Run() }()
+	select {
+	case <-app.Ready():
+	case err := <-done:
+		t.Fatalf("Run: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+app.Addr()+"/products", bytes.NewBufferString(`{"name":"Bread","quantity":3,"price":1.5}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer k")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "Bread")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, app.Shutdown(ctx))
+	require.NoError(t, <-done)
+
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "Bread")
+
+	_, err = http.Get("http://" + app.Addr() + "/ping")
+	assert.Error(t, err)
+	assert.NoError(t, app.Shutdown(ctx))
+}
+
+func TestServerChi_ShutdownBeforeRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[]`), 0644))
+
+	app := application.NewServerChi(&application.ConfigServerChi{
+		ServerAddress:  "127.0.0.1:0",
+		LoaderFilePath: path,
+		APIKeys:        []middlewares.APIKey{{Name: "test", Key: "k", Role: middlewares.RoleReader}},
+		LogLevel:       "error",
+	})
+	require.NoError(t, app.Shutdown(context.Background()))
+
+	assert.NoError(t, app.Run())
+	select {
+	case <-app.Ready():
+		t.Fatal("Run served after Shutdown")
+	default:
+	}
+
+	ran := false
+	app.OnShutdown(func(context.Context) error { ran = true; return nil })
+	assert.True(t, ran, "a hook registered after Shutdown runs at once")
+}
+
+func TestServerChi_HealthEndpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[]`), 0644))
+
+	app := application.NewServerChi(&application.ConfigServerChi{
+		ServerAddress:  "127.0.0.1:0",
+		LoaderFilePath: path,
+		StorageBackend: application.StorageJournal,
+		APIKeys:        []middlewares.APIKey{{Name: "test", Key: "k", Role: middlewares.RoleReader}},
+		LogLevel:       "error",
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- app.Run() }()
+	select {
+	case <-app.Ready():
+	case err := <-done:
+		t.Fatalf("Run: %v", err)
+	}
+	defer app.Shutdown(context.Background())
+
+	get := func(path string) (int, map[string]any) {
+		res, err := http.Get("http://" + app.Addr() + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return res.StatusCode, body
+	}
+
+	status, body := get("/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "up", body["status"])
+
+	status, body = get("/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "up", body["status"])
+	checks, _ := body["checks"].(map[string]any)
+	for _, name := range []string{"catalog_file", "repository", "shutdown", "store_writable"} {
+		assert.Contains(t, checks, name)
+	}
+
+	require.NoError(t, os.Remove(path))
+	status, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "down", body["status"])
+}
+
+func TestServerChi_MetricsNeedAdmin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[]`), 0644))
+
+	app := application.NewServerChi(&application.ConfigServerChi{
+		ServerAddress:  "127.0.0.1:0",
+		LoaderFilePath: path,
+		StorageBackend: application.StorageMemory,
+		APIKeys: []middlewares.APIKey{
+			{Name: "pos", Key: "reader-key", Role: middlewares.RoleReader},
+			{Name: "ops", Key: "admin-key", Role: middlewares.RoleAdmin},
+		},
+		LogLevel: "error",
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- app.Run() }()
+	select {
+	case <-app.Ready():
+	case err := <-done:
+		t.Fatalf("Run: %v", err)
+	}
+	defer app.Shutdown(context.Background())
+
+	get := func(key string) int {
+		req, err := http.NewRequest(http.MethodGet, "http://"+app.Addr()+"/metrics", nil)
+		require.NoError(t, err)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get(""))
+	assert.Equal(t, http.StatusForbidden, get("reader-key"))
+	assert.Equal(t, http.StatusOK, get("admin-key"))
+}
+
+func TestServerChi_ImportAndExportCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.csv")
+	require.NoError(t, os.WriteFile(path, []byte("id,name,quantity,code_value,is_published,expiration,price\n"+
+		"1,Milk,1,M1,true,,2\n"+
+		"2,Tea,5,T1,true,,3\n"), 0644))
+
+	app := application.NewServerChi(&application.ConfigServerChi{
+		ServerAddress:  "127.0.0.1:0",
+		LoaderFilePath: path,
+		APIKeys:        []middlewares.APIKey{{Name: "buyer", Key: "k", Role: middlewares.RoleEditor}},
+		LogLevel:       "error",
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- app.Run() }()
+	select {
+	case <-app.Ready():
+	case err := <-done:
+		t.Fatalf("Run: %v", err)
+	}
+	defer app.Shutdown(context.Background())
+
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, "http://"+app.Addr()+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "text/csv")
+		req.Header.Set("Authorization", "Bearer k")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var b bytes.Buffer
+		b.ReadFrom(res.Body)
+		return res.StatusCode, b.String()
+	}
+
+	// Milk hands M1 over to the new Bread before Oats claims T1, which Tea
+	// still holds; product 9 does not exist and product 2 appears twice.
+	upload := "ID,Name,Code,Price\n" +
+		"1,Milk,M2,2.5\n" +
+		",Bread,M1,1\n" +
+		",Oats,T1,4\n" +
+		"9,Ghost,,1\n" +
+		"2,Tea,T1,3\n" +
+		"2,Tea,T1,3\n"
+	status, body := do(http.MethodPost, "/products/import?dry_run=true&columns=Code:code_value", upload)
+	assert.Equal(t, http.StatusOK, status)
+	type rowErr struct {
+		Line int    `json:"line"`
+		Code string `json:"code"`
+	}
+	var report struct {
+		Data struct {
+			Rows    int      `json:"rows"`
+			Created int      `json:"created"`
+			Updated int      `json:"updated"`
+			Errors  []rowErr `json:"errors"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &report))
+	assert.Equal(t, 6, report.Data.Rows)
+	assert.Equal(t, 1, report.Data.Created)
+	assert.Equal(t, 2, report.Data.Updated)
+	assert.Equal(t, []rowErr{{4, "code_value_exists"}, {5, "not_found"}, {7, "duplicate_id"}}, report.Data.Errors)
+
+	status, _ = do(http.MethodPost, "/products/import?columns=Code:code_value", upload)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+	status, body = do(http.MethodPost, "/products/import?columns=Code:code_value", "ID,Name,Code,Price\n"+
+		"1,Milk,M2,2.5\n"+
+		",Bread,M1,1\n")
+	assert.Equal(t, http.StatusOK, status, body)
+
+	status, body = do(http.MethodGet, "/products/export", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "id,name,quantity,code_value,is_published,expiration,price\n"+
+		"1,Milk,0,M2,false,,2.5\n"+
+		"2,Tea,5,T1,true,,3\n"+
+		"3,Bread,0,M1,false,,1\n", body)
+
+	// The catalog file itself is CSV.
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(b))
+}
+
+func TestServerChi_RunFailsOnBadBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[]`), 0644))
+
+	app := application.NewServerChi(&application.ConfigServerChi{
+		ServerAddress:  "127.0.0.1:0",
+		LoaderFilePath: path,
+		StorageBackend: "tape",
+		APIKeys:        []middlewares.APIKey{{Name: "test", Key: "k", Role: middlewares.RoleReader}},
+		LogLevel:       "error",
+	})
+
+	assert.EqualError(t, app.Run(), `unknown storage backend "tape"`)
+}
+
+func TestServerChi_RunFailsWithoutAuthentication(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[]`), 0644))
+
+	app := application.NewServerChi(&application.ConfigServerChi{
+		ServerAddress:  "127.0.0.1:0",
+		LoaderFilePath: path,
+		LogLevel:       "error",
+	})
+
+	assert.EqualError(t, app.Run(), "no authentication configured: set API keys, client certs or a JWT secret")
+}
+
+func TestServerChi_RunsWithTokensOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[]`), 0644))
+	secret := strings.Repeat("s", token.MinSecretLength)
+
+	app := application.NewServerChi(&application.ConfigServerChi{
+		ServerAddress:  "127.0.0.1:0",
+		LoaderFilePath: path,
+		StorageBackend: application.StorageMemory,
+		JWTSecret:      secret,
+		LogLevel:       "error",
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- app.Run() }()
+	select {
+	case <-app.Ready():
+	case err := <-done:
+		t.Fatalf("Run: %v", err)
+	}
+	defer app.Shutdown(context.Background())
+
+	tokens, err := token.NewHS256(&token.ConfigHS256{Secret: []byte(secret)})
+	require.NoError(t, err)
+	tok, _, err := tokens.Mint("pos", string(middlewares.RoleReader), 0)
+	require.NoError(t, err)
+
+	get := func(credential string) int {
+		req, err := http.NewRequest(http.MethodGet, "http://"+app.Addr()+"/products", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+credential)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get(tok))
+	assert.Equal(t, http.StatusUnauthorized, get("not-a-key"))
+}
+
+// writeSelfSigned writes a self-signed certificate for cn, usable as its own
+// CA, and its key.
+func writeSelfSigned(t *testing.T, certFile, keyFile, cn string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func TestServerChi_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "products.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[]`), 0644))
+	serverCert, serverKey := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeSelfSigned(t, serverCert, serverKey, "localhost")
+	clientCert, clientKey := filepath.Join(dir, "till.crt"), filepath.Join(dir, "till.key")
+	writeSelfSigned(t, clientCert, clientKey, "store-12-till-3")
+
+	app := application.NewServerChi(&application.ConfigServerChi{
+		ServerAddress:   "127.0.0.1:0",
+		LoaderFilePath:  path,
+		StorageBackend:  application.StorageMemory,
+		APIKeys:         []middlewares.APIKey{{Name: "test", Key: "k", Role: middlewares.RoleReader}},
+		LogLevel:        "error",
+		TLSCertFile:     serverCert,
+		TLSKeyFile:      serverKey,
+		TLSMinVersion:   "1.3",
+		TLSClientCAFile: clientCert,
+		ClientCerts:     []middlewares.ClientCert{{CommonName: "store-12-till-3", Role: middlewares.RoleEditor}},
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- app.Run() }()
+	select {
+	case <-app.Ready():
+	case err := <-done:
+		t.Fatalf("Run: %v", err)
+	}
+	defer app.Shutdown(context.Background())
+
+	roots := x509.NewCertPool()
+	b, err := os.ReadFile(serverCert)
+	require.NoError(t, err)
+	require.True(t, roots.AppendCertsFromPEM(b))
+	till, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	require.NoError(t, err)
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: certs,
+		}}}
+	}
+	url := "https://" + app.Addr() + "/products"
+
+	// The till authenticates with its certificate alone.
+	res, err := client(till).Post(url, "application/json", bytes.NewBufferString(`{"name":"Bread","quantity":3,"price":1.5}`))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// Client certificates are optional: API keys keep working.
+	res, err = client().Get(url)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer k")
+	res, err = client().Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = http.Get("http://" + app.Addr() + "/ping")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "plain HTTP is refused")
+}
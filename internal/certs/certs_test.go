@@ -0,0 +1,148 @@
+package certs_test
+
+import (
+	"app/internal/certs"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSigned writes a self-signed certificate for cn and its key.
+func writeSelfSigned(t *testing.T, certFile, keyFile, cn string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func commonName(t *testing.T, r *certs.Reloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeSelfSigned(t, certFile, keyFile, "v1")
+
+	r, err := certs.NewReloader(&certs.ConfigReloader{CertFile: certFile, KeyFile: keyFile, Interval: -1})
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, "v1", commonName(t, r))
+
+	reloaded, err := r.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	writeSelfSigned(t, certFile, keyFile, "v2")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	reloaded, err = r.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "v2", commonName(t, r))
+
+	// A half-written renewal keeps the previous pair.
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0600))
+	_, err = r.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, "v2", commonName(t, r))
+}
+
+func TestReloader_WatchesFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeSelfSigned(t, certFile, keyFile, "v1")
+
+	r, err := certs.NewReloader(&certs.ConfigReloader{CertFile: certFile, KeyFile: keyFile, Interval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer r.Close()
+
+	writeSelfSigned(t, certFile, keyFile, "v2")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	assert.Eventually(t, func() bool { return commonName(t, r) == "v2" }, time.Second, 10*time.Millisecond)
+}
+
+func TestNewReloader_MissingFiles(t *testing.T) {
+	_, err := certs.NewReloader(&certs.ConfigReloader{CertFile: "missing.crt", KeyFile: "missing.key"})
+	assert.Error(t, err)
+}
+
+func TestNewServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	writeSelfSigned(t, caFile, filepath.Join(dir, "ca.key"), "ca")
+	get := func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil }
+
+	c, err := certs.NewServerConfig(&certs.ConfigServer{GetCertificate: get})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), c.MinVersion)
+	assert.Nil(t, c.CipherSuites)
+	assert.Equal(t, tls.NoClientCert, c.ClientAuth)
+
+	c, err = certs.NewServerConfig(&certs.ConfigServer{
+		GetCertificate: get,
+		MinVersion:     "1.3",
+		CipherPolicy:   certs.PolicyModern,
+		ClientCAFile:   caFile,
+		ClientAuth:     certs.ClientAuthRequire,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), c.MinVersion)
+	assert.NotEmpty(t, c.CipherSuites)
+	for _, id := range c.CipherSuites {
+		for _, insecure := range tls.InsecureCipherSuites() {
+			assert.NotEqual(t, insecure.ID, id)
+		}
+	}
+	assert.Equal(t, tls.RequireAndVerifyClientCert, c.ClientAuth)
+	assert.NotNil(t, c.ClientCAs)
+
+	for name, cfg := range map[string]certs.ConfigServer{
+		"no certificate": {},
+		"old version":    {GetCertificate: get, MinVersion: "1.0"},
+		"unknown policy": {GetCertificate: get, CipherPolicy: "paranoid"},
+		"unknown auth":   {GetCertificate: get, ClientCAFile: caFile, ClientAuth: "maybe"},
+		"empty CA file":  {GetCertificate: get, ClientCAFile: filepath.Join(dir, "ca.key")},
+	} {
+		_, err := certs.NewServerConfig(&cfg)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,142 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	// PolicyDefault keeps Go's default cipher suites.
+	PolicyDefault = "default"
+	// PolicyModern allows only forward-secret AEAD suites on TLS 1.2.
+	PolicyModern = "modern"
+
+	// ClientAuthOptional verifies client certificates that are presented;
+	// clients without one authenticate with keys or tokens.
+	ClientAuthOptional = "optional"
+	// ClientAuthRequire rejects handshakes without a valid client certificate.
+	ClientAuthRequire = "require"
+)
+
+// modernSuites are the TLS 1.2 suites of PolicyModern. TLS 1.3 suites are not
+// configurable and all qualify.
+var modernSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+type ConfigServer struct {
+	// GetCertificate supplies the server certificate, e.g. a Reloader's.
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// MinVersion is "1.2" or "1.3"; "1.2" by default.
+	MinVersion string
+	// CipherPolicy is PolicyDefault or PolicyModern; PolicyDefault by default.
+	CipherPolicy string
+	// ClientCAFile is a PEM bundle of the CAs client certificates are
+	// verified against; empty disables client certificates.
+	ClientCAFile string
+	// ClientAuth is ClientAuthOptional or ClientAuthRequire;
+	// ClientAuthOptional by default.
+	ClientAuth string
+}
+
+// NewServerConfig builds the TLS settings of the server.
+func NewServerConfig(cfg *ConfigServer) (*tls.Config, error) {
+	defaultConfig := &ConfigServer{
+		MinVersion:   "1.2",
+		CipherPolicy: PolicyDefault,
+		ClientAuth:   ClientAuthOptional,
+	}
+	if cfg != nil {
+		defaultConfig.GetCertificate = cfg.GetCertificate
+		if cfg.MinVersion != "" {
+			defaultConfig.MinVersion = cfg.MinVersion
+		}
+		if cfg.CipherPolicy != "" {
+			defaultConfig.CipherPolicy = cfg.CipherPolicy
+		}
+		defaultConfig.ClientCAFile = cfg.ClientCAFile
+		if cfg.ClientAuth != "" {
+			defaultConfig.ClientAuth = cfg.ClientAuth
+		}
+	}
+	if defaultConfig.GetCertificate == nil {
+		return nil, errors.New("tls: no certificate")
+	}
+
+	c := &tls.Config{GetCertificate: defaultConfig.GetCertificate}
+
+	var err error
+	if c.MinVersion, err = ParseVersion(defaultConfig.MinVersion); err != nil {
+		return nil, err
+	}
+	if c.CipherSuites, err = CipherSuites(defaultConfig.CipherPolicy); err != nil {
+		return nil, err
+	}
+
+	if defaultConfig.ClientCAFile != "" {
+		if c.ClientAuth, err = ParseClientAuth(defaultConfig.ClientAuth); err != nil {
+			return nil, err
+		}
+		if c.ClientCAs, err = LoadCertPool(defaultConfig.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// ParseVersion maps "1.2" and "1.3" to their TLS version.
+func ParseVersion(s string) (uint16, error) {
+	switch s {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("tls: unsupported minimum version %q, use 1.2 or 1.3", s)
+}
+
+// CipherSuites returns the TLS 1.2 suites of policy; nil means Go's defaults.
+func CipherSuites(policy string) ([]uint16, error) {
+	switch policy {
+	case PolicyDefault:
+		return nil, nil
+	case PolicyModern:
+		return append([]uint16(nil), modernSuites...), nil
+	}
+	return nil, fmt.Errorf("tls: unknown cipher policy %q, use %s or %s", policy, PolicyDefault, PolicyModern)
+}
+
+// ParseClientAuth maps ClientAuthOptional and ClientAuthRequire to their
+// verifying tls.ClientAuthType.
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return 0, fmt.Errorf("tls: unknown client auth %q, use %s or %s", s, ClientAuthOptional, ClientAuthRequire)
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("tls: no certificates in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,151 @@
+// Package certs serves TLS certificates that are replaced on disk while the
+// server runs, and builds the server's TLS settings.
+package certs
+
+import (
+	"app/internal/logging"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type ConfigReloader struct {
+	CertFile string
+	KeyFile  string
+	// Interval is how often the files are checked for changes; a negative
+	// interval disables reloading.
+	Interval time.Duration
+}
+
+// NewReloader loads the key pair and watches its files for changes.
+func NewReloader(cfg *ConfigReloader) (*Reloader, error) {
+	defaultConfig := &ConfigReloader{
+		Interval: 30 * time.Second,
+	}
+	if cfg != nil {
+		defaultConfig.CertFile = cfg.CertFile
+		defaultConfig.KeyFile = cfg.KeyFile
+		if cfg.Interval != 0 {
+			defaultConfig.Interval = cfg.Interval
+		}
+	}
+
+	r := &Reloader{
+		certFile: defaultConfig.CertFile,
+		keyFile:  defaultConfig.KeyFile,
+		done:     make(chan struct{}),
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	if defaultConfig.Interval > 0 {
+		r.wg.Add(1)
+		go r.watchLoop(defaultConfig.Interval)
+	}
+
+	return r, nil
+}
+
+// Reloader holds a certificate and its key, reloaded when either file's
+// modification time or size changes. A pair that fails to load is logged and
+// the previous one kept, so a half-written renewal never takes TLS down.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	stamp [2]fileStamp
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// GetCertificate returns the current certificate; it fits
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Reload loads the key pair if its files changed since the last load and
+// reports whether it did.
+func (r *Reloader) Reload() (reloaded bool, err error) {
+	stamp, err := r.stat()
+	if err != nil {
+		return
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && stamp == r.stamp
+	r.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("tls key pair %s, %s: %w", r.certFile, r.keyFile, err)
+	}
+
+	r.mu.Lock()
+	r.cert, r.stamp = &cert, stamp
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// Close stops watching the files.
+func (r *Reloader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	r.wg.Wait()
+	return nil
+}
+
+func (r *Reloader) stat() (stamp [2]fileStamp, err error) {
+	for i, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return stamp, err
+		}
+		stamp[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return
+}
+
+func (r *Reloader) watchLoop(interval time.Duration) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger := logging.FromContext(context.Background())
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			switch {
+			case err != nil:
+				logger.Error("tls certificate reload failed", "error", err)
+			case reloaded:
+				logger.Info("tls certificate reloaded", "cert_file", r.certFile)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
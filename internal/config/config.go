@@ -0,0 +1,288 @@
+// Package config assembles the server configuration from, in increasing
+// precedence, built-in defaults, a YAML or JSON file, environment variables
+// and command line flags.
+package config
+
+import (
+	"app/internal/application"
+	"app/internal/certs"
+	"app/internal/logging"
+	"app/internal/middlewares"
+	"app/internal/token"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Config is the whole server configuration. Field names in files are the
+// yaml/json tags.
+type Config struct {
+	Address   string    `yaml:"address" json:"address"`
+	DataPath  string    `yaml:"data_path" json:"data_path"`
+	Storage   Storage   `yaml:"storage" json:"storage"`
+	Auth      Auth      `yaml:"auth" json:"auth"`
+	Log       Log       `yaml:"log" json:"log"`
+	RateLimit RateLimit `yaml:"rate_limit" json:"rate_limit"`
+	Server    Server    `yaml:"server" json:"server"`
+	TLS       TLS       `yaml:"tls" json:"tls"`
+}
+
+type Storage struct {
+	// Backend is memory, file or journal.
+	Backend       string   `yaml:"backend" json:"backend"`
+	FlushInterval Duration `yaml:"flush_interval" json:"flush_interval"`
+	JournalPath   string   `yaml:"journal_path" json:"journal_path"`
+	CompactEvery  int      `yaml:"compact_every" json:"compact_every"`
+}
+
+type Auth struct {
+	APIKeys     []middlewares.APIKey `yaml:"api_keys" json:"api_keys"`
+	APIKeysFile string               `yaml:"api_keys_file" json:"api_keys_file"`
+	JWTSecret   string               `yaml:"jwt_secret" json:"jwt_secret"`
+	JWTIssuer   string               `yaml:"jwt_issuer" json:"jwt_issuer"`
+	JWTAudience string               `yaml:"jwt_audience" json:"jwt_audience"`
+	JWTTTL      Duration             `yaml:"jwt_ttl" json:"jwt_ttl"`
+}
+
+type Log struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" json:"level"`
+}
+
+// Limit is a token bucket; a negative rate disables it.
+type Limit struct {
+	Rate  float64 `yaml:"rate" json:"rate"`
+	Burst int     `yaml:"burst" json:"burst"`
+}
+
+type RateLimit struct {
+	Read         Limit `yaml:"read" json:"read"`
+	Write        Limit `yaml:"write" json:"write"`
+	AuthFailures Limit `yaml:"auth_failures" json:"auth_failures"`
+}
+
+type Server struct {
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" json:"read_header_timeout"`
+	ReadTimeout       Duration `yaml:"read_timeout" json:"read_timeout"`
+	WriteTimeout      Duration `yaml:"write_timeout" json:"write_timeout"`
+	IdleTimeout       Duration `yaml:"idle_timeout" json:"idle_timeout"`
+	MaxHeaderBytes    int      `yaml:"max_header_bytes" json:"max_header_bytes"`
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+}
+
+// TLS is off unless CertFile and KeyFile are set.
+type TLS struct {
+	CertFile       string   `yaml:"cert_file" json:"cert_file"`
+	KeyFile        string   `yaml:"key_file" json:"key_file"`
+	ReloadInterval Duration `yaml:"reload_interval" json:"reload_interval"`
+	// MinVersion is 1.2 or 1.3.
+	MinVersion string `yaml:"min_version" json:"min_version"`
+	// CipherPolicy is default or modern.
+	CipherPolicy string `yaml:"cipher_policy" json:"cipher_policy"`
+	ClientCAFile string `yaml:"client_ca_file" json:"client_ca_file"`
+	// ClientAuth is optional or require.
+	ClientAuth  string                   `yaml:"client_auth" json:"client_auth"`
+	ClientCerts []middlewares.ClientCert `yaml:"client_certs" json:"client_certs"`
+}
+
+// Duration reads and writes durations as strings such as "15s".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() Config {
+	return Config{
+		Address:  ":8080",
+		DataPath: "docs/db/products.json",
+		Storage: Storage{
+			Backend:      application.StorageFile,
+			CompactEvery: 1000,
+		},
+		Log: Log{Level: "info"},
+		RateLimit: RateLimit{
+			Read:         Limit{Rate: 20, Burst: 40},
+			Write:        Limit{Rate: 5, Burst: 10},
+			AuthFailures: Limit{Rate: 0.1, Burst: 10},
+		},
+		Server: Server{
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(15 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(time.Minute),
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   Duration(15 * time.Second),
+		},
+		TLS: TLS{
+			ReloadInterval: Duration(30 * time.Second),
+			MinVersion:     "1.2",
+			CipherPolicy:   certs.PolicyDefault,
+			ClientAuth:     certs.ClientAuthOptional,
+		},
+	}
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		fail("address: %v", err)
+	}
+	if c.DataPath == "" {
+		fail("data_path: must not be empty")
+	}
+
+	switch c.Storage.Backend {
+	case application.StorageMemory, application.StorageFile, application.StorageJournal:
+	default:
+		fail("storage.backend: %q is not memory, file or journal", c.Storage.Backend)
+	}
+	if c.Storage.FlushInterval < 0 {
+		fail("storage.flush_interval: must not be negative")
+	}
+	if c.Storage.CompactEvery < 1 {
+		fail("storage.compact_every: must be at least 1")
+	}
+
+	if len(c.Auth.APIKeys) > 0 {
+		if _, err := middlewares.NewAuthenticator(c.Auth.APIKeys); err != nil {
+			fail("auth.api_keys: %v", err)
+		}
+	}
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < token.MinSecretLength {
+		fail("auth.jwt_secret: must be at least %d bytes", token.MinSecretLength)
+	}
+	if c.Auth.JWTTTL < 0 {
+		fail("auth.jwt_ttl: must not be negative")
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level: %q is not debug, info, warn or error", c.Log.Level)
+	}
+
+	for _, l := range []struct {
+		name string
+		Limit
+	}{{"read", c.RateLimit.Read}, {"write", c.RateLimit.Write}, {"auth_failures", c.RateLimit.AuthFailures}} {
+		if l.Rate > 0 && l.Burst < 1 {
+			fail("rate_limit.%s.burst: must be at least 1", l.name)
+		}
+		if l.Rate == 0 {
+			fail("rate_limit.%s.rate: must not be zero, use a negative rate to disable", l.name)
+		}
+	}
+
+	for _, d := range []struct {
+		name  string
+		value Duration
+	}{
+		{"read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"read_timeout", c.Server.ReadTimeout},
+		{"write_timeout", c.Server.WriteTimeout},
+		{"idle_timeout", c.Server.IdleTimeout},
+		{"shutdown_timeout", c.Server.ShutdownTimeout},
+	} {
+		if d.value <= 0 {
+			fail("server.%s: must be positive", d.name)
+		}
+	}
+	if c.Server.MaxHeaderBytes < 1 {
+		fail("server.max_header_bytes: must be positive")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		fail("tls: cert_file and key_file go together")
+	}
+	if _, err := certs.ParseVersion(c.TLS.MinVersion); err != nil {
+		fail("tls.min_version: %q is not 1.2 or 1.3", c.TLS.MinVersion)
+	}
+	if _, err := certs.CipherSuites(c.TLS.CipherPolicy); err != nil {
+		fail("tls.cipher_policy: %q is not %s or %s", c.TLS.CipherPolicy, certs.PolicyDefault, certs.PolicyModern)
+	}
+	if _, err := certs.ParseClientAuth(c.TLS.ClientAuth); err != nil {
+		fail("tls.client_auth: %q is not %s or %s", c.TLS.ClientAuth, certs.ClientAuthOptional, certs.ClientAuthRequire)
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		fail("tls.client_ca_file: needs cert_file and key_file")
+	}
+	if len(c.TLS.ClientCerts) > 0 {
+		if c.TLS.ClientCAFile == "" {
+			fail("tls.client_certs: needs client_ca_file")
+		}
+		if err := new(middlewares.Authenticator).AcceptClientCerts(c.TLS.ClientCerts); err != nil {
+			fail("tls.client_certs: %v", err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+const redacted = "REDACTED"
+
+// Redacted returns a copy of c with every secret replaced, fit for printing.
+func (c Config) Redacted() Config {
+	if len(c.Auth.APIKeys) > 0 {
+		keys := make([]middlewares.APIKey, len(c.Auth.APIKeys))
+		copy(keys, c.Auth.APIKeys)
+		for i := range keys {
+			keys[i].Key = redacted
+		}
+		c.Auth.APIKeys = keys
+	}
+	if c.Auth.JWTSecret != "" {
+		c.Auth.JWTSecret = redacted
+	}
+	return c
+}
+
+// ServerChi converts c into the application configuration.
+func (c Config) ServerChi() *application.ConfigServerChi {
+	return &application.ConfigServerChi{
+		ServerAddress:        c.Address,
+		LoaderFilePath:       c.DataPath,
+		StorageBackend:       c.Storage.Backend,
+		FlushInterval:        time.Duration(c.Storage.FlushInterval),
+		JournalPath:          c.Storage.JournalPath,
+		CompactEvery:         c.Storage.CompactEvery,
+		APIKeys:              c.Auth.APIKeys,
+		APIKeysFile:          c.Auth.APIKeysFile,
+		JWTSecret:            c.Auth.JWTSecret,
+		JWTIssuer:            c.Auth.JWTIssuer,
+		JWTAudience:          c.Auth.JWTAudience,
+		JWTTTL:               time.Duration(c.Auth.JWTTTL),
+		ReadRateLimit:        middlewares.Limit(c.RateLimit.Read),
+		WriteRateLimit:       middlewares.Limit(c.RateLimit.Write),
+		AuthFailureRateLimit: middlewares.Limit(c.RateLimit.AuthFailures),
+		LogLevel:             c.Log.Level,
+		ReadHeaderTimeout:    time.Duration(c.Server.ReadHeaderTimeout),
+		ReadTimeout:          time.Duration(c.Server.ReadTimeout),
+		WriteTimeout:         time.Duration(c.Server.WriteTimeout),
+		IdleTimeout:          time.Duration(c.Server.IdleTimeout),
+		MaxHeaderBytes:       c.Server.MaxHeaderBytes,
+		ShutdownTimeout:      time.Duration(c.Server.ShutdownTimeout),
+		TLSCertFile:          c.TLS.CertFile,
+		TLSKeyFile:           c.TLS.KeyFile,
+		TLSReloadInterval:    time.Duration(c.TLS.ReloadInterval),
+		TLSMinVersion:        c.TLS.MinVersion,
+		TLSCipherPolicy:      c.TLS.CipherPolicy,
+		TLSClientCAFile:      c.TLS.ClientCAFile,
+		TLSClientAuth:        c.TLS.ClientAuth,
+		ClientCerts:          c.TLS.ClientCerts,
+	}
+}
@@ -0,0 +1,204 @@
+package config_test
+
+import (
+	"app/internal/config"
+	"app/internal/middlewares"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func envOf(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	c, opts, err := config.Load(nil, envOf(nil))
+	require.NoError(t, err)
+	assert.Equal(t, config.Default(), c)
+	assert.Equal(t, config.Options{}, opts)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "products.yaml", `
+address: ":9000"
+data_path: /var/lib/products.json
+storage:
+  backend: journal
+  flush_interval: 2s
+log:
+  level: warn
+rate_limit:
+  read: {rate: 100, burst: 200}
+`)
+
+	c, opts, err := config.Load(
+		[]string{"-config", path, "-log-level", "debug", "-rate-limit-write", "-1"},
+		envOf(map[string]string{
+			"SERVER_ADDRESS":  ":9100",
+			"LOG_LEVEL":       "error",
+			"API_KEYS":        "pos:editor:k1",
+			"RATE_LIMIT_READ": "50",
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, path, opts.File)
+
+	// File over defaults.
+	assert.Equal(t, "/var/lib/products.json", c.DataPath)
+	assert.Equal(t, "journal", c.Storage.Backend)
+	assert.Equal(t, config.Duration(2*time.Second), c.Storage.FlushInterval)
+	assert.Equal(t, 1000, c.Storage.CompactEvery)
+	// Env over file; a bare rate keeps the burst from the file.
+	assert.Equal(t, ":9100", c.Address)
+	assert.Equal(t, config.Limit{Rate: 50, Burst: 200}, c.RateLimit.Read)
+	assert.Equal(t, []middlewares.APIKey{{Name: "pos", Role: middlewares.RoleEditor, Key: "k1"}}, c.Auth.APIKeys)
+	// Flags over env.
+	assert.Equal(t, "debug", c.Log.Level)
+	assert.Equal(t, config.Limit{Rate: -1, Burst: 10}, c.RateLimit.Write)
+
+	srv := c.ServerChi()
+	assert.Equal(t, ":9100", srv.ServerAddress)
+	assert.Equal(t, 2*time.Second, srv.FlushInterval)
+	assert.Equal(t, middlewares.Limit{Rate: 50, Burst: 200}, srv.ReadRateLimit)
+}
+
+func TestLoad_JSONFileFromEnv(t *testing.T) {
+	path := writeFile(t, "products.json", `{"auth":{"api_keys":[{"name":"ops","key":"k","role":"admin"}]},"server":{"shutdown_timeout":"1m"}}`)
+
+	c, _, err := config.Load(nil, envOf(map[string]string{"CONFIG_FILE": path}))
+	require.NoError(t, err)
+	assert.Equal(t, []middlewares.APIKey{{Name: "ops", Key: "k", Role: middlewares.RoleAdmin}}, c.Auth.APIKeys)
+	assert.Equal(t, config.Duration(time.Minute), c.Server.ShutdownTimeout)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := map[string]struct {
+		args []string
+		env  map[string]string
+		msg  string
+	}{
+		"unknown file key": {
+			args: []string{"-config", writeFile(t, "c.yaml", "adress: :9000\n")},
+			msg:  "field adress not found",
+		},
+		"bad env value": {
+			env: map[string]string{"COMPACT_EVERY": "often"},
+			msg: `env COMPACT_EVERY: "often" is not an integer`,
+		},
+		"bad flag value": {
+			args: []string{"-read-timeout", "soon"},
+			msg:  "flag -read-timeout:",
+		},
+		"unknown flag": {
+			args: []string{"-verbose"},
+			msg:  "flag provided but not defined: -verbose",
+		},
+	}
+	for name, tt := range tests {
+		_, _, err := config.Load(tt.args, envOf(tt.env))
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), tt.msg, name)
+		}
+	}
+}
+
+func TestLoad_ReportsEveryInvalidSetting(t *testing.T) {
+	_, _, err := config.Load([]string{
+		"-addr", "8080",
+		"-storage", "tape",
+		"-log-level", "loud",
+		"-jwt-secret", "short",
+		"-rate-limit-read", "0",
+		"-api-keys", "a:owner:k",
+	}, envOf(nil))
+	require.Error(t, err)
+
+	for _, msg := range []string{
+		"address: ",
+		`storage.backend: "tape"`,
+		`log.level: "loud"`,
+		"auth.jwt_secret: must be at least 32 bytes",
+		"rate_limit.read.rate: must not be zero",
+		`auth.api_keys: api key a: unknown role "owner"`,
+	} {
+		assert.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestWrite_RedactsSecrets(t *testing.T) {
+	c, opts, err := config.Load([]string{"-print-config", "-api-keys", "pos:editor:supersecret", "-jwt-secret", "0123456789abcdef0123456789abcdef"}, envOf(nil))
+	require.NoError(t, err)
+	assert.True(t, opts.PrintConfig)
+
+	var buf bytes.Buffer
+	require.NoError(t, config.Write(&buf, c.Redacted()))
+
+	out := buf.String()
+	assert.NotContains(t, out, "supersecret")
+	assert.NotContains(t, out, "0123456789abcdef")
+	assert.Contains(t, out, "jwt_secret: REDACTED")
+	assert.Contains(t, out, "key: REDACTED")
+	assert.Contains(t, out, "shutdown_timeout: 15s")
+	// The loaded config keeps the real secrets.
+	assert.Equal(t, "supersecret", c.Auth.APIKeys[0].Key)
+}
+
+func TestLoad_TLS(t *testing.T) {
+	path := writeFile(t, "products.yaml", `
+tls:
+  cert_file: /etc/products/tls.crt
+  key_file: /etc/products/tls.key
+  client_ca_file: /etc/products/stores-ca.crt
+  client_certs:
+    - {common_name: store-12-till-3, role: editor}
+`)
+
+	c, _, err := config.Load([]string{"-config", path, "-tls-min-version", "1.3"}, envOf(map[string]string{"TLS_CIPHER_POLICY": "modern"}))
+	require.NoError(t, err)
+
+	srv := c.ServerChi()
+	assert.Equal(t, "/etc/products/tls.crt", srv.TLSCertFile)
+	assert.Equal(t, "1.3", srv.TLSMinVersion)
+	assert.Equal(t, "modern", srv.TLSCipherPolicy)
+	assert.Equal(t, "optional", srv.TLSClientAuth)
+	assert.Equal(t, 30*time.Second, srv.TLSReloadInterval)
+	assert.Equal(t, []middlewares.ClientCert{{CommonName: "store-12-till-3", Role: middlewares.RoleEditor}}, srv.ClientCerts)
+}
+
+func TestLoad_InvalidTLS(t *testing.T) {
+	_, _, err := config.Load([]string{
+		"-tls-cert", "tls.crt",
+		"-tls-min-version", "1.1",
+		"-tls-cipher-policy", "paranoid",
+		"-tls-client-auth", "maybe",
+		"-tls-client-certs", "till:owner",
+	}, envOf(nil))
+	require.Error(t, err)
+
+	for _, msg := range []string{
+		"tls: cert_file and key_file go together",
+		`tls.min_version: "1.1"`,
+		`tls.cipher_policy: "paranoid"`,
+		`tls.client_auth: "maybe"`,
+		"tls.client_certs: needs client_ca_file",
+		`tls.client_certs: client cert till: unknown role "owner"`,
+	} {
+		assert.Contains(t, err.Error(), msg)
+	}
+}
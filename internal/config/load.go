@@ -0,0 +1,241 @@
+package config
+
+import (
+	"app/internal/middlewares"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Options are the command line switches that are not settings.
+type Options struct {
+	// File is the config file, from -config or CONFIG_FILE.
+	File string
+	// PrintConfig asks to print the effective, redacted configuration and
+	// exit.
+	PrintConfig bool
+}
+
+// setting is one option that environment variables and flags can set.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"addr", "SERVER_ADDRESS", "listen address, host:port", setString(func(c *Config) *string { return &c.Address })},
+	{"data", "DATA_PATH", "product catalog file, CSV when it ends in .csv, JSON otherwise", setString(func(c *Config) *string { return &c.DataPath })},
+	{"storage", "STORAGE_BACKEND", "storage backend: memory, file or journal", setString(func(c *Config) *string { return &c.Storage.Backend })},
+	{"flush-interval", "FLUSH_INTERVAL", "batch file writes over this interval, 0 saves on every write", setDuration(func(c *Config) *Duration { return &c.Storage.FlushInterval })},
+	{"journal", "JOURNAL_PATH", "journal file, defaults to the data file with a .journal suffix", setString(func(c *Config) *string { return &c.Storage.JournalPath })},
+	{"compact-every", "COMPACT_EVERY", "journal records that trigger a compaction", setInt(func(c *Config) *int { return &c.Storage.CompactEvery })},
+	{"api-keys", "API_KEYS", "API keys as comma separated name:role:key", setAPIKeys},
+	{"api-keys-file", "API_KEYS_FILE", "JSON file of API keys", setString(func(c *Config) *string { return &c.Auth.APIKeysFile })},
+	{"jwt-secret", "JWT_SECRET", "HS256 secret enabling bearer tokens", setString(func(c *Config) *string { return &c.Auth.JWTSecret })},
+	{"jwt-issuer", "JWT_ISSUER", "issuer of minted and accepted tokens", setString(func(c *Config) *string { return &c.Auth.JWTIssuer })},
+	{"jwt-audience", "JWT_AUDIENCE", "audience of minted and accepted tokens", setString(func(c *Config) *string { return &c.Auth.JWTAudience })},
+	{"jwt-ttl", "JWT_TTL", "lifetime of minted tokens", setDuration(func(c *Config) *Duration { return &c.Auth.JWTTTL })},
+	{"log-level", "LOG_LEVEL", "debug, info, warn or error", setString(func(c *Config) *string { return &c.Log.Level })},
+	{"rate-limit-read", "RATE_LIMIT_READ", "read limit per client as rate/burst, e.g. 20/40; a negative rate disables it", setLimit(func(c *Config) *Limit { return &c.RateLimit.Read })},
+	{"rate-limit-write", "RATE_LIMIT_WRITE", "write limit per client as rate/burst, e.g. 5/10", setLimit(func(c *Config) *Limit { return &c.RateLimit.Write })},
+	{"rate-limit-auth-failures", "RATE_LIMIT_AUTH_FAILURES", "failed authentications per remote IP as rate/burst, e.g. 0.1/10", setLimit(func(c *Config) *Limit { return &c.RateLimit.AuthFailures })},
+	{"read-header-timeout", "READ_HEADER_TIMEOUT", "time to read request headers", setDuration(func(c *Config) *Duration { return &c.Server.ReadHeaderTimeout })},
+	{"read-timeout", "READ_TIMEOUT", "time to read a whole request", setDuration(func(c *Config) *Duration { return &c.Server.ReadTimeout })},
+	{"write-timeout", "WRITE_TIMEOUT", "time to write a response", setDuration(func(c *Config) *Duration { return &c.Server.WriteTimeout })},
+	{"idle-timeout", "IDLE_TIMEOUT", "keep-alive idle time", setDuration(func(c *Config) *Duration { return &c.Server.IdleTimeout })},
+	{"max-header-bytes", "MAX_HEADER_BYTES", "maximum request header size", setInt(func(c *Config) *int { return &c.Server.MaxHeaderBytes })},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "drain deadline on SIGINT/SIGTERM", setDuration(func(c *Config) *Duration { return &c.Server.ShutdownTimeout })},
+	{"tls-cert", "TLS_CERT_FILE", "PEM certificate enabling HTTPS", setString(func(c *Config) *string { return &c.TLS.CertFile })},
+	{"tls-key", "TLS_KEY_FILE", "PEM private key of the certificate", setString(func(c *Config) *string { return &c.TLS.KeyFile })},
+	{"tls-reload-interval", "TLS_RELOAD_INTERVAL", "how often the certificate files are checked for changes, negative disables", setDuration(func(c *Config) *Duration { return &c.TLS.ReloadInterval })},
+	{"tls-min-version", "TLS_MIN_VERSION", "minimum TLS version: 1.2 or 1.3", setString(func(c *Config) *string { return &c.TLS.MinVersion })},
+	{"tls-cipher-policy", "TLS_CIPHER_POLICY", "TLS 1.2 cipher suites: default or modern", setString(func(c *Config) *string { return &c.TLS.CipherPolicy })},
+	{"tls-client-ca", "TLS_CLIENT_CA_FILE", "PEM CA bundle verifying client certificates", setString(func(c *Config) *string { return &c.TLS.ClientCAFile })},
+	{"tls-client-auth", "TLS_CLIENT_AUTH", "client certificates: optional or require", setString(func(c *Config) *string { return &c.TLS.ClientAuth })},
+	{"tls-client-certs", "TLS_CLIENT_CERTS", "client certificate roles as comma separated cn:role", setClientCerts},
+}
+
+// Load builds the configuration for the command line args (without the
+// program name) and the environment looked up through env, usually
+// os.LookupEnv. The result is validated.
+func Load(args []string, env func(string) (string, bool)) (c Config, opts Options, err error) {
+	fs, flags := newFlagSet(&opts)
+	fs.SetOutput(io.Discard)
+	if err = fs.Parse(args); err != nil {
+		return c, opts, err
+	}
+	if fs.NArg() > 0 {
+		return c, opts, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	c = Default()
+
+	if opts.File == "" {
+		opts.File, _ = env("CONFIG_FILE")
+	}
+	if opts.File != "" {
+		if err = decodeFile(opts.File, &c); err != nil {
+			return c, opts, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := env(s.env); ok {
+			if err = s.set(&c, v); err != nil {
+				return c, opts, fmt.Errorf("env %s: %w", s.env, err)
+			}
+		}
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range settings {
+		if set[s.flag] {
+			if err = s.set(&c, *flags[s.flag]); err != nil {
+				return c, opts, fmt.Errorf("flag -%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if err = c.Validate(); err != nil {
+		return c, opts, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return c, opts, nil
+}
+
+// Usage describes the flags and their environment variables.
+func Usage(w io.Writer) {
+	fs, _ := newFlagSet(&Options{})
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// newFlagSet declares every flag. Settings are plain strings so Load can tell
+// which flags were given and parse them like environment variables.
+func newFlagSet(opts *Options) (*flag.FlagSet, map[string]*string) {
+	fs := flag.NewFlagSet("products", flag.ContinueOnError)
+	fs.StringVar(&opts.File, "config", "", "YAML or JSON config file (env CONFIG_FILE)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration, secrets redacted, and exit")
+
+	flags := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flags[s.flag] = fs.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	return fs, flags
+}
+
+// decodeFile overlays the file at path on c; keys the file leaves out keep
+// their value. Unknown keys are errors, to catch typos.
+func decodeFile(path string, c *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err = dec.Decode(c); err == io.EOF {
+			err = nil
+		}
+	default:
+		return fmt.Errorf("config %s: unknown format, use .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+// Write prints c as YAML.
+func Write(w io.Writer, c Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func setString(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func setInt(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func setDuration(field func(*Config) *Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = Duration(d)
+		return nil
+	}
+}
+
+// setLimit parses rate/burst; a bare rate keeps the burst.
+func setLimit(field func(*Config) *Limit) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		l := field(c)
+		rate, burst, hasBurst := strings.Cut(v, "/")
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not rate/burst", v)
+		}
+		b := l.Burst
+		if hasBurst {
+			if b, err = strconv.Atoi(burst); err != nil {
+				return fmt.Errorf("%q is not rate/burst", v)
+			}
+		}
+		l.Rate, l.Burst = r, b
+		return nil
+	}
+}
+
+func setAPIKeys(c *Config, v string) error {
+	keys, err := middlewares.ParseAPIKeys(v)
+	if err != nil {
+		return err
+	}
+	c.Auth.APIKeys = keys
+	return nil
+}
+
+func setClientCerts(c *Config, v string) error {
+	certs, err := middlewares.ParseClientCerts(v)
+	if err != nil {
+		return err
+	}
+	c.TLS.ClientCerts = certs
+	return nil
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateLayout is the dd/mm/yyyy format used by the product catalog.
+const DateLayout = "02/01/2006"
+
+// dateLayouts are the accepted input formats, tried in order.
+var dateLayouts = []string{DateLayout, time.DateOnly, time.RFC3339}
+
+// Date is a calendar day without time of day, stored as midnight UTC. The
+// zero Date means no date and is encoded as an empty string.
+type Date struct {
+	t time.Time
+}
+
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{t: time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// DateOf returns the calendar day of t in t's location.
+func DateOf(t time.Time) Date {
+	return NewDate(t.Date())
+}
+
+// ParseDate accepts dd/mm/yyyy, yyyy-mm-dd or an RFC 3339 timestamp.
+// Impossible days such as 31/02/2021 are rejected.
+func ParseDate(s string) (Date, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return DateOf(t), nil
+		}
+	}
+	return Date{}, fmt.Errorf("invalid date %q: expected dd/mm/yyyy or yyyy-mm-dd", s)
+}
+
+func (d Date) Time() time.Time {
+	return d.t
+}
+
+func (d Date) IsZero() bool {
+	return d.t.IsZero()
+}
+
+func (d Date) Before(o Date) bool {
+	return d.t.Before(o.t)
+}
+
+func (d Date) After(o Date) bool {
+	return d.t.After(o.t)
+}
+
+// Compare returns -1, 0 or +1 as d is before, equal to or after o.
+func (d Date) Compare(o Date) int {
+	return d.t.Compare(o.t)
+}
+
+func (d Date) AddDays(n int) Date {
+	return Date{t: d.t.AddDate(0, 0, n)}
+}
+
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.t.Format(DateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid date %s: expected a string", b)
+	}
+	if s == "" {
+		*d = Date{}
+		return nil
+	}
+
+	parsed, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+
+	return nil
+}
@@ -6,6 +6,53 @@ type Product struct {
 	Quantity    int     `json:"quantity"`
 	CodeValue   string  `json:"code_value"`
 	IsPublished bool    `json:"is_published"`
-	Expiration  string  `json:"expiration"`
+	Expiration  Date    `json:"expiration"`
 	Price       float64 `json:"price"`
 }
+
+// ProductPatcher computes the new state of a product from its current one.
+// Repositories call Apply while holding the product, so the read-modify-write
+// is atomic.
+type ProductPatcher interface {
+	Apply(p Product) (Product, error)
+}
+
+// ProductPatch is a partial update: nil fields are left untouched, so zero
+// values such as a quantity of 0 or IsPublished false can still be set.
+type ProductPatch struct {
+	Name        *string
+	Quantity    *int
+	CodeValue   *string
+	IsPublished *bool
+	Expiration  *Date
+	Price       *float64
+}
+
+// Apply returns p with the fields set in the patch replaced.
+func (pp ProductPatch) Apply(p Product) (Product, error) {
+	if pp.Name != nil {
+		p.Name = *pp.Name
+	}
+	if pp.Quantity != nil {
+		p.Quantity = *pp.Quantity
+	}
+	if pp.CodeValue != nil {
+		p.CodeValue = *pp.CodeValue
+	}
+	if pp.IsPublished != nil {
+		p.IsPublished = *pp.IsPublished
+	}
+	if pp.Expiration != nil {
+		p.Expiration = *pp.Expiration
+	}
+	if pp.Price != nil {
+		p.Price = *pp.Price
+	}
+	return p, nil
+}
+
+// ProductMatch is a product returned by a text search with its relevance.
+type ProductMatch struct {
+	Product
+	Score float64 `json:"score"`
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error classes. Every error that should reach a client as something other
+// than an internal failure wraps one of them, and the handler package maps
+// each class to a single HTTP status.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("validation failed")
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// Error is a client-facing message tagged with its class. errors.Is(err,
+// ErrNotFound) and friends see through it.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Errorf formats a message as an Error of the given class.
+func Errorf(kind error, format string, args ...any) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	ErrCodeValueExists = Errorf(ErrConflict, "Code value already exists.")
+	ErrPatchTestFailed = Errorf(ErrConflict, "Patch test operation failed.")
+)
+
+func ProductNotFound(id int) error {
+	return Errorf(ErrNotFound, "Product %d not found.", id)
+}
@@ -0,0 +1,153 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type FilterOp string
+
+const (
+	FilterEq       FilterOp = "eq"
+	FilterNe       FilterOp = "ne"
+	FilterGt       FilterOp = "gt"
+	FilterGte      FilterOp = "gte"
+	FilterLt       FilterOp = "lt"
+	FilterLte      FilterOp = "lte"
+	FilterContains FilterOp = "contains"
+	FilterPrefix   FilterOp = "prefix"
+)
+
+var (
+	orderedOps = []FilterOp{FilterEq, FilterNe, FilterGt, FilterGte, FilterLt, FilterLte}
+	textOps    = []FilterOp{FilterEq, FilterNe, FilterContains, FilterPrefix}
+	equalOps   = []FilterOp{FilterEq, FilterNe}
+)
+
+// filterField knows which operators a field supports and how to parse a
+// filter value into a probe product, which is then compared against
+// candidates with productFieldCompare.
+type filterField struct {
+	ops   []FilterOp
+	parse func(probe *Product, raw string) error
+	text  func(p Product) string
+}
+
+var filterFields = map[string]filterField{
+	"id": {ops: orderedOps, parse: func(probe *Product, raw string) (err error) {
+		probe.Id, err = strconv.Atoi(raw)
+		return
+	}},
+	"name": {ops: textOps, text: func(p Product) string { return p.Name }, parse: func(probe *Product, raw string) error {
+		probe.Name = raw
+		return nil
+	}},
+	"quantity": {ops: orderedOps, parse: func(probe *Product, raw string) (err error) {
+		probe.Quantity, err = strconv.Atoi(raw)
+		return
+	}},
+	"code_value": {ops: textOps, text: func(p Product) string { return p.CodeValue }, parse: func(probe *Product, raw string) error {
+		probe.CodeValue = raw
+		return nil
+	}},
+	"is_published": {ops: equalOps, parse: func(probe *Product, raw string) (err error) {
+		probe.IsPublished, err = strconv.ParseBool(raw)
+		return
+	}},
+	"expiration": {ops: orderedOps, parse: func(probe *Product, raw string) (err error) {
+		probe.Expiration, err = ParseDate(raw)
+		return
+	}},
+	"price": {ops: orderedOps, parse: func(probe *Product, raw string) (err error) {
+		probe.Price, err = strconv.ParseFloat(raw, 64)
+		return
+	}},
+}
+
+// ProductCondition compares one product field against a typed value.
+type ProductCondition struct {
+	Field string
+	Op    FilterOp
+	probe Product
+}
+
+// NewProductCondition parses raw according to the type of field and checks
+// that op applies to it.
+func NewProductCondition(field string, op FilterOp, raw string) (c ProductCondition, err error) {
+	f, ok := filterFields[field]
+	if !ok {
+		return c, fmt.Errorf("unknown filter field %q", field)
+	}
+
+	supported := false
+	for _, o := range f.ops {
+		supported = supported || o == op
+	}
+	if !supported {
+		return c, fmt.Errorf("operator %q does not apply to %s", op, field)
+	}
+
+	c = ProductCondition{Field: field, Op: op}
+	if err = f.parse(&c.probe, raw); err != nil {
+		return c, fmt.Errorf("invalid value %q for %s", raw, field)
+	}
+
+	return c, nil
+}
+
+func (c ProductCondition) Match(p Product) bool {
+	if c.Field == "expiration" && p.Expiration.IsZero() {
+		return false
+	}
+
+	switch c.Op {
+	case FilterContains, FilterPrefix:
+		text := filterFields[c.Field].text
+		value, want := strings.ToLower(text(p)), strings.ToLower(text(c.probe))
+		if c.Op == FilterContains {
+			return strings.Contains(value, want)
+		}
+		return strings.HasPrefix(value, want)
+	}
+
+	cmp := productFieldCompare[c.Field](p, c.probe)
+	switch c.Op {
+	case FilterEq:
+		return cmp == 0
+	case FilterNe:
+		return cmp != 0
+	case FilterGt:
+		return cmp > 0
+	case FilterGte:
+		return cmp >= 0
+	case FilterLt:
+		return cmp < 0
+	case FilterLte:
+		return cmp <= 0
+	}
+	return false
+}
+
+// ProductFilter combines conditions with AND, or with OR when Any is set.
+// An empty filter matches every product.
+type ProductFilter struct {
+	Any        bool
+	Conditions []ProductCondition
+}
+
+func (f ProductFilter) Match(p Product) bool {
+	if len(f.Conditions) == 0 {
+		return true
+	}
+	for _, c := range f.Conditions {
+		matched := c.Match(p)
+		if f.Any && matched {
+			return true
+		}
+		if !f.Any && !matched {
+			return false
+		}
+	}
+	return !f.Any
+}
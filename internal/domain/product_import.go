@@ -0,0 +1,34 @@
+package domain
+
+// Codes of the row errors an import finds against the catalog, next to the
+// field codes of the dto package.
+const (
+	ImportCodeNotFound        = "not_found"
+	ImportCodeDuplicateId     = "duplicate_id"
+	ImportCodeCodeValueExists = "code_value_exists"
+)
+
+// ProductImportRow is one product of an import, Line locating it in the
+// upload. A product with Id 0 is created; any other id replaces that
+// product, which must exist.
+type ProductImportRow struct {
+	Line    int
+	Product Product
+}
+
+// ProductImportError explains why a row can not be imported.
+type ProductImportError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ProductImportReport tells what an import did, or would do when DryRun.
+type ProductImportReport struct {
+	DryRun  bool                 `json:"dry_run"`
+	Rows    int                  `json:"rows"`
+	Created int                  `json:"created"`
+	Updated int                  `json:"updated"`
+	Errors  []ProductImportError `json:"errors"`
+}
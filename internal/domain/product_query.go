@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// productFieldCompare orders two products by one field, keyed by the field's
+// JSON name.
+var productFieldCompare = map[string]func(a, b Product) int{
+	"id":         func(a, b Product) int { return cmp.Compare(a.Id, b.Id) },
+	"name":       func(a, b Product) int { return strings.Compare(a.Name, b.Name) },
+	"quantity":   func(a, b Product) int { return cmp.Compare(a.Quantity, b.Quantity) },
+	"code_value": func(a, b Product) int { return strings.Compare(a.CodeValue, b.CodeValue) },
+	"is_published": func(a, b Product) int {
+		return cmp.Compare(boolToInt(a.IsPublished), boolToInt(b.IsPublished))
+	},
+	"expiration": func(a, b Product) int { return a.Expiration.Compare(b.Expiration) },
+	"price":      func(a, b Product) int { return cmp.Compare(a.Price, b.Price) },
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type ProductSortField struct {
+	Field string
+	Desc  bool
+}
+
+// ProductSort is an ordered list of sort keys. Products equal on every key
+// are ordered by ascending id, so the order is total and stable across
+// pages.
+type ProductSort []ProductSortField
+
+// ParseProductSort reads a comma separated list of field names, each
+// optionally prefixed with "-" for descending order, e.g. "price,-name".
+func ParseProductSort(s string) (ProductSort, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var sort ProductSort
+	for _, part := range strings.Split(s, ",") {
+		f := ProductSortField{Field: strings.TrimSpace(part)}
+		if strings.HasPrefix(f.Field, "-") {
+			f.Desc = true
+			f.Field = f.Field[1:]
+		}
+		if _, ok := productFieldCompare[f.Field]; !ok {
+			return nil, fmt.Errorf("unknown sort field %q", f.Field)
+		}
+		sort = append(sort, f)
+	}
+
+	return sort, nil
+}
+
+func (s ProductSort) String() string {
+	parts := make([]string, len(s))
+	for i, f := range s {
+		if f.Desc {
+			parts[i] = "-" + f.Field
+		} else {
+			parts[i] = f.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ById reports whether s is the natural ascending id order.
+func (s ProductSort) ById() bool {
+	return len(s) == 0 || (len(s) == 1 && s[0].Field == "id" && !s[0].Desc)
+}
+
+// Compare returns -1, 0 or +1 as a sorts before, equal to or after b.
+func (s ProductSort) Compare(a, b Product) int {
+	for _, f := range s {
+		c := productFieldCompare[f.Field](a, b)
+		if f.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(a.Id, b.Id)
+}
+
+// ProductPageQuery selects one page of the catalog in Sort order. When After
+// is set the page starts right after that product (keyset pagination) and
+// Offset is ignored.
+type ProductPageQuery struct {
+	Sort   ProductSort
+	Limit  int
+	Offset int
+	After  *Product
+}
@@ -0,0 +1,232 @@
+package dto
+
+import (
+	"app/internal/domain"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+const (
+	CodeUnknownField = "unknown_field"
+	CodeInvalidType  = "invalid_type"
+	CodeReadOnly     = "read_only"
+	CodeInvalidOp    = "invalid_op"
+)
+
+// DecodeMergePatch reads an RFC 7396 JSON Merge Patch. Unlike a plain JSON
+// body, a member set to null removes the value, which for a product field
+// means resetting it to its zero value.
+func DecodeMergePatch(b []byte) (c PatchRequestProducts, err error) {
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return
+	}
+
+	var v ValidationErrors
+	mergeField(&v, raw, "name", &c.Name)
+	mergeField(&v, raw, "quantity", &c.Quantity)
+	mergeField(&v, raw, "code_value", &c.CodeValue)
+	mergeField(&v, raw, "is_published", &c.IsPublished)
+	mergeField(&v, raw, "expiration", &c.Expiration)
+	mergeField(&v, raw, "price", &c.Price)
+	if len(v) > 0 {
+		return c, v
+	}
+
+	return c, nil
+}
+
+func mergeField[T any](v *ValidationErrors, raw map[string]json.RawMessage, key string, dst **T) {
+	value, ok := raw[key]
+	if !ok {
+		return
+	}
+
+	*dst = new(T)
+	if isNull(value) {
+		return
+	}
+	if err := json.Unmarshal(value, *dst); err != nil {
+		v.add(key, CodeInvalidType, "must be "+fieldTypes[key])
+	}
+}
+
+// fieldTypes names the JSON value each product field takes, for the
+// messages of values that do not decode.
+var fieldTypes = map[string]string{
+	"id":           "an integer",
+	"name":         "a string",
+	"quantity":     "an integer",
+	"code_value":   "a string",
+	"is_published": "a boolean",
+	"expiration":   "a date (DD/MM/YYYY or YYYY-MM-DD)",
+	"price":        "a number",
+}
+
+func isNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// patchField describes how a JSON Pointer into a product reads, writes and
+// decodes its value.
+type patchField struct {
+	decode func(raw json.RawMessage) (any, error)
+	get    func(p domain.Product) any
+	set    func(p *domain.Product, v any)
+}
+
+func decodeAs[T any](raw json.RawMessage) (any, error) {
+	var v T
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+var patchFields = map[string]patchField{
+	"/id": {
+		decode: decodeAs[int],
+		get:    func(p domain.Product) any { return p.Id },
+	},
+	"/name": {
+		decode: decodeAs[string],
+		get:    func(p domain.Product) any { return p.Name },
+		set:    func(p *domain.Product, v any) { p.Name = v.(string) },
+	},
+	"/quantity": {
+		decode: decodeAs[int],
+		get:    func(p domain.Product) any { return p.Quantity },
+		set:    func(p *domain.Product, v any) { p.Quantity = v.(int) },
+	},
+	"/code_value": {
+		decode: decodeAs[string],
+		get:    func(p domain.Product) any { return p.CodeValue },
+		set:    func(p *domain.Product, v any) { p.CodeValue = v.(string) },
+	},
+	"/is_published": {
+		decode: decodeAs[bool],
+		get:    func(p domain.Product) any { return p.IsPublished },
+		set:    func(p *domain.Product, v any) { p.IsPublished = v.(bool) },
+	},
+	"/expiration": {
+		decode: decodeAs[domain.Date],
+		get:    func(p domain.Product) any { return p.Expiration },
+		set:    func(p *domain.Product, v any) { p.Expiration = v.(domain.Date) },
+	},
+	"/price": {
+		decode: decodeAs[float64],
+		get:    func(p domain.Product) any { return p.Price },
+		set:    func(p *domain.Product, v any) { p.Price = v.(float64) },
+	},
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type jsonPatchStep struct {
+	op    string
+	path  string
+	field patchField
+	value any
+}
+
+// JSONPatch is a parsed RFC 6902 document restricted to the add, remove,
+// replace and test operations on top-level product fields. It implements
+// domain.ProductPatcher.
+type JSONPatch []jsonPatchStep
+
+// DecodeJSONPatch parses and type-checks every operation up front, so that
+// Apply can only fail on a test operation or on the resulting product being
+// invalid.
+func DecodeJSONPatch(b []byte) (JSONPatch, error) {
+	var ops []jsonPatchOperation
+	if err := json.Unmarshal(b, &ops); err != nil {
+		return nil, err
+	}
+
+	var (
+		v     ValidationErrors
+		patch = make(JSONPatch, 0, len(ops))
+	)
+	for i, o := range ops {
+		prefix := "/" + strconv.Itoa(i)
+
+		field, ok := patchFields[o.Path]
+		if !ok {
+			v.add(prefix+"/path", CodeUnknownField, fmt.Sprintf("%q is not a product field", o.Path))
+			continue
+		}
+
+		step := jsonPatchStep{op: o.Op, path: o.Path, field: field}
+		switch o.Op {
+		case "add", "replace", "test":
+			if o.Op != "test" && field.set == nil {
+				v.add(prefix+"/path", CodeReadOnly, fmt.Sprintf("%q can not be modified", o.Path))
+				continue
+			}
+			// No product field is nullable, so a null value counts as missing.
+			if len(o.Value) == 0 || isNull(o.Value) {
+				v.add(prefix+"/value", CodeRequired, "must be present for "+o.Op)
+				continue
+			}
+			value, err := field.decode(o.Value)
+			if err != nil {
+				v.add(prefix+"/value", CodeInvalidType, "must be "+fieldTypes[strings.TrimPrefix(o.Path, "/")])
+				continue
+			}
+			step.value = value
+		case "remove":
+			if field.set == nil {
+				v.add(prefix+"/path", CodeReadOnly, fmt.Sprintf("%q can not be modified", o.Path))
+				continue
+			}
+		default:
+			v.add(prefix+"/op", CodeInvalidOp, fmt.Sprintf("unsupported operation %q", o.Op))
+			continue
+		}
+		patch = append(patch, step)
+	}
+	if len(v) > 0 {
+		return nil, v
+	}
+
+	return patch, nil
+}
+
+// Apply runs the operations in order. A failed test aborts the whole patch
+// with domain.ErrPatchTestFailed; a result that breaks the product rules is
+// reported as ValidationErrors.
+func (jp JSONPatch) Apply(p domain.Product) (domain.Product, error) {
+	for _, s := range jp {
+		switch s.op {
+		case "add", "replace":
+			s.field.set(&p, s.value)
+		case "remove":
+			// A product always has every field; removing one resets it.
+			s.field.set(&p, s.field.get(domain.Product{}))
+		case "test":
+			if s.field.get(p) != s.value {
+				return domain.Product{}, domain.Errorf(domain.ErrPatchTestFailed, "Patch test failed: %s is %v.", strings.TrimPrefix(s.path, "/"), s.field.get(p))
+			}
+		}
+	}
+
+	var v ValidationErrors
+	validateName(&v, p.Name)
+	validateQuantity(&v, p.Quantity)
+	validatePrice(&v, p.Price)
+	if len(v) > 0 {
+		return domain.Product{}, v
+	}
+
+	return p, nil
+}
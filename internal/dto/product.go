@@ -2,6 +2,7 @@ package dto
 
 import (
 	"app/internal/domain"
+	"fmt"
 )
 
 type CreateRequestProducts struct {
@@ -13,13 +14,88 @@ type CreateRequestProducts struct {
 	Price       float64 `json:"price"`
 }
 
-func (c CreateRequestProducts) ToDomain() domain.Product {
+// Validate checks a full product payload, as sent to POST and PUT.
+func (c CreateRequestProducts) Validate() ValidationErrors {
+	var v ValidationErrors
+	validateName(&v, c.Name)
+	validateQuantity(&v, c.Quantity)
+	validatePrice(&v, c.Price)
+	validateExpiration(&v, c.Expiration)
+	return v
+}
+
+// ToDomain converts the request into a product, rejecting an expiration that
+// is not a real calendar date.
+func (c CreateRequestProducts) ToDomain() (domain.Product, error) {
+	var expiration domain.Date
+	if c.Expiration != "" {
+		var err error
+		expiration, err = domain.ParseDate(c.Expiration)
+		if err != nil {
+			return domain.Product{}, fmt.Errorf("expiration: %w", err)
+		}
+	}
+
 	return domain.Product{
 		Name:        c.Name,
 		Quantity:    c.Quantity,
 		CodeValue:   c.CodeValue,
 		IsPublished: c.IsPublished,
-		Expiration:  c.Expiration,
+		Expiration:  expiration,
+		Price:       c.Price,
+	}, nil
+}
+
+// PatchRequestProducts is the body of a partial update. Fields absent from
+// the JSON stay nil and are not changed; fields present are set even to
+// their zero value.
+type PatchRequestProducts struct {
+	Name        *string  `json:"name"`
+	Quantity    *int     `json:"quantity"`
+	CodeValue   *string  `json:"code_value"`
+	IsPublished *bool    `json:"is_published"`
+	Expiration  *string  `json:"expiration"`
+	Price       *float64 `json:"price"`
+}
+
+// Validate checks only the fields present in the patch.
+func (c PatchRequestProducts) Validate() ValidationErrors {
+	var v ValidationErrors
+	if c.Name != nil {
+		validateName(&v, *c.Name)
+	}
+	if c.Quantity != nil {
+		validateQuantity(&v, *c.Quantity)
+	}
+	if c.Price != nil {
+		validatePrice(&v, *c.Price)
+	}
+	if c.Expiration != nil {
+		validateExpiration(&v, *c.Expiration)
+	}
+	return v
+}
+
+func (c PatchRequestProducts) ToDomain() (domain.ProductPatch, error) {
+	patch := domain.ProductPatch{
+		Name:        c.Name,
+		Quantity:    c.Quantity,
+		CodeValue:   c.CodeValue,
+		IsPublished: c.IsPublished,
 		Price:       c.Price,
 	}
+
+	if c.Expiration != nil {
+		var expiration domain.Date
+		if *c.Expiration != "" {
+			var err error
+			expiration, err = domain.ParseDate(*c.Expiration)
+			if err != nil {
+				return domain.ProductPatch{}, fmt.Errorf("expiration: %w", err)
+			}
+		}
+		patch.Expiration = &expiration
+	}
+
+	return patch, nil
 }
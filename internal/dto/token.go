@@ -0,0 +1,62 @@
+package dto
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	CodeInvalidRole     = "invalid_role"
+	CodeInvalidDuration = "invalid_duration"
+)
+
+// TokenRoles are the roles a minted token may carry. Admin is left out on
+// purpose: terminals never manage other credentials.
+var TokenRoles = []string{"reader", "editor"}
+
+// MintTokenRequest asks for a token identifying a POS terminal. Role
+// defaults to reader and TTL, a Go duration such as "15m", to the server's
+// token lifetime.
+type MintTokenRequest struct {
+	TerminalId string `json:"terminal_id"`
+	Role       string `json:"role"`
+	TTL        string `json:"ttl"`
+}
+
+func (m MintTokenRequest) Validate() ValidationErrors {
+	var v ValidationErrors
+	if strings.TrimSpace(m.TerminalId) == "" {
+		v.add("terminal_id", CodeRequired, "must not be empty")
+	}
+	if m.Role != "" && !contains(TokenRoles, m.Role) {
+		v.add("role", CodeInvalidRole, "must be one of "+strings.Join(TokenRoles, ", "))
+	}
+	if m.TTL != "" {
+		if d, err := time.ParseDuration(m.TTL); err != nil || d <= 0 {
+			v.add("ttl", CodeInvalidDuration, "must be a positive duration such as 15m")
+		}
+	}
+	return v
+}
+
+// Params returns the role and lifetime to mint with; a zero lifetime means
+// the server default. Call it on a validated request.
+func (m MintTokenRequest) Params() (role string, ttl time.Duration) {
+	role = m.Role
+	if role == "" {
+		role = TokenRoles[0]
+	}
+	if m.TTL != "" {
+		ttl, _ = time.ParseDuration(m.TTL)
+	}
+	return
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package dto
+
+import (
+	"app/internal/domain"
+	"strings"
+)
+
+const (
+	CodeRequired    = "required"
+	CodeNegative    = "negative"
+	CodeNotPositive = "not_positive"
+	CodeInvalidDate = "invalid_date"
+	// CodeInvalidNumber and CodeInvalidBool report CSV cells that do not
+	// parse; JSON payloads are typed and never produce them.
+	CodeInvalidNumber = "invalid_number"
+	CodeInvalidBool   = "invalid_bool"
+)
+
+// FieldError describes one invalid field of a request payload.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects every FieldError found in a payload, so clients
+// can fix all of them in one round trip.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, e := range v {
+		msgs = append(msgs, e.Field+": "+e.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap classifies every ValidationErrors as domain.ErrValidation.
+func (v ValidationErrors) Unwrap() error {
+	return domain.ErrValidation
+}
+
+func (v *ValidationErrors) add(field, code, message string) {
+	*v = append(*v, FieldError{Field: field, Code: code, Message: message})
+}
+
+func validateName(v *ValidationErrors, name string) {
+	if strings.TrimSpace(name) == "" {
+		v.add("name", CodeRequired, "must not be empty")
+	}
+}
+
+func validateQuantity(v *ValidationErrors, quantity int) {
+	if quantity < 0 {
+		v.add("quantity", CodeNegative, "must not be negative")
+	}
+}
+
+func validatePrice(v *ValidationErrors, price float64) {
+	if price <= 0 {
+		v.add("price", CodeNotPositive, "must be greater than zero")
+	}
+}
+
+func validateExpiration(v *ValidationErrors, expiration string) {
+	if expiration == "" {
+		return
+	}
+	if _, err := domain.ParseDate(expiration); err != nil {
+		v.add("expiration", CodeInvalidDate, err.Error())
+	}
+}
+
+// Has reports whether v already holds an error for field.
+func (v ValidationErrors) Has(field string) bool {
+	for _, e := range v {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package fsutil_test
+
+import (
+	"app/internal/fsutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Run("creates the file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "data")
+
+		require.NoError(t, fsutil.WriteFileAtomic(path, []byte("new")))
+
+		raw, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(raw))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("replaces the file keeping its mode", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "data")
+		require.NoError(t, os.WriteFile(path, []byte("old contents"), 0o640))
+		require.NoError(t, os.Chmod(path, 0o640))
+
+		require.NoError(t, fsutil.WriteFileAtomic(path, []byte("new")))
+
+		raw, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(raw))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "data")
+
+		err := fsutil.WriteFileAtomic(path, []byte("new"))
+
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"app/internal/dto"
+	"app/internal/problem"
+	"app/internal/token"
+	"net/http"
+	"time"
+
+	"github.com/bootcamp-go/web/request"
+	"github.com/bootcamp-go/web/response"
+)
+
+// TokenMinter issues signed tokens for a subject.
+type TokenMinter interface {
+	Mint(subject, role string, ttl time.Duration) (string, token.Claims, error)
+}
+
+func NewAuthDefault(mt TokenMinter) *AuthDefault {
+	return &AuthDefault{mt: mt}
+}
+
+type AuthDefault struct {
+	mt TokenMinter
+}
+
+// MintToken issues a short-lived token for a POS terminal, to be sent as
+// "Authorization: Bearer <token>".
+func (h *AuthDefault) MintToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input dto.MintTokenRequest
+		if err := request.JSON(r, &input); err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+
+		if errs := input.Validate(); len(errs) > 0 {
+			WriteValidation(w, r, "Invalid token request.", errs)
+			return
+		}
+
+		role, ttl := input.Params()
+		tk, claims, err := h.mt.Mint(input.TerminalId, role, ttl)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+
+		response.JSON(w, http.StatusCreated, map[string]any{
+			"message": "created",
+			"data": map[string]any{
+				"token":       tk,
+				"token_type":  "Bearer",
+				"terminal_id": claims.Subject,
+				"role":        claims.Role,
+				"expires_at":  time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339),
+			},
+		})
+	}
+}
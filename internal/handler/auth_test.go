@@ -0,0 +1,72 @@
+package handler_test
+
+import (
+	"app/internal/handler"
+	"app/internal/token"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMintToken(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tokens, err := token.NewHS256(&token.ConfigHS256{
+		Secret: []byte("0123456789abcdef0123456789abcdef"),
+		Now:    func() time.Time { return now },
+	})
+	require.NoError(t, err)
+	hd := handler.NewAuthDefault(tokens)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"defaults", `{"terminal_id":"pos-7"}`, http.StatusCreated},
+		{"editor for an hour", `{"terminal_id":"pos-7","role":"editor","ttl":"1h"}`, http.StatusCreated},
+		{"admin role", `{"terminal_id":"pos-7","role":"admin"}`, http.StatusUnprocessableEntity},
+		{"missing terminal", `{"ttl":"soon"}`, http.StatusUnprocessableEntity},
+		{"beyond max ttl", `{"terminal_id":"pos-7","ttl":"48h"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/tokens", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			hd.MintToken()(w, req)
+
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/tokens", bytes.NewBufferString(`{"terminal_id":"pos-7","role":"editor","ttl":"1h"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	hd.MintToken()(w, req)
+
+	var body struct {
+		Data struct {
+			Token      string `json:"token"`
+			TokenType  string `json:"token_type"`
+			TerminalId string `json:"terminal_id"`
+			Role       string `json:"role"`
+			ExpiresAt  string `json:"expires_at"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "Bearer", body.Data.TokenType)
+	assert.Equal(t, "pos-7", body.Data.TerminalId)
+	assert.Equal(t, "editor", body.Data.Role)
+	assert.Equal(t, "2024-05-01T13:00:00Z", body.Data.ExpiresAt)
+
+	claims, err := tokens.Verify(body.Data.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "pos-7", claims.Subject)
+}
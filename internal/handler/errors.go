@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"app/internal/domain"
+	"app/internal/dto"
+	"app/internal/logging"
+	"app/internal/problem"
+	"errors"
+	"net/http"
+)
+
+// problemCodeOf maps an error from the service or repository to its problem
+// code: specific errors first, then their domain class. Anything
+// unclassified is an internal error.
+func problemCodeOf(err error) problem.Code {
+	switch {
+	case errors.Is(err, domain.ErrCodeValueExists):
+		return problem.CodeValueExists
+	case errors.Is(err, domain.ErrPatchTestFailed):
+		return problem.PatchTestFailed
+	case errors.Is(err, domain.ErrNotFound):
+		return problem.NotFound
+	case errors.Is(err, domain.ErrConflict):
+		return problem.Conflict
+	case errors.Is(err, domain.ErrValidation):
+		return problem.ValidationFailed
+	case errors.Is(err, domain.ErrUnauthorized):
+		return problem.Unauthorized
+	default:
+		return problem.Internal
+	}
+}
+
+// WriteError is the single place where service and repository errors become
+// responses. Validation problems list every failing field; internal errors
+// are logged with the request but do not leak their message.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var verr dto.ValidationErrors
+	if errors.As(err, &verr) {
+		WriteValidation(w, r, "Invalid product data.", verr)
+		return
+	}
+
+	code := problemCodeOf(err)
+
+	detail := err.Error()
+	if code == problem.Internal {
+		logging.FromContext(r.Context()).Error("request failed", "error", err)
+		detail = ""
+	}
+
+	problem.Write(w, r, code, detail)
+}
+
+// WriteValidation writes a validation-failed problem listing errs, with
+// detail saying what was invalid, e.g. "Invalid token request.".
+func WriteValidation(w http.ResponseWriter, r *http.Request, detail string, errs dto.ValidationErrors) {
+	p := problem.New(r, problem.ValidationFailed, detail)
+	p.Errors = errs
+	p.Write(w)
+}
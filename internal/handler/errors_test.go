@@ -0,0 +1,54 @@
+package handler_test
+
+import (
+	"app/internal/domain"
+	"app/internal/dto"
+	"app/internal/handler"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteError_MapsErrorsToProblems(t *testing.T) {
+	tests := []struct {
+		err  error
+		body string
+	}{
+		{domain.ProductNotFound(3), `{"type":"/problems/not-found","title":"Resource not found","status":404,"detail":"Product 3 not found.","instance":"/products/3","code":"not-found","request_id":"req-1"}`},
+		{domain.Errorf(domain.ErrPatchTestFailed, "Patch test failed: quantity is 4."), `{"type":"/problems/patch-test-failed","title":"Patch test failed","status":409,"detail":"Patch test failed: quantity is 4.","instance":"/products/3","code":"patch-test-failed","request_id":"req-1"}`},
+		{domain.ErrCodeValueExists, `{"type":"/problems/code-value-exists","title":"Code value already exists","status":409,"detail":"Code value already exists.","instance":"/products/3","code":"code-value-exists","request_id":"req-1"}`},
+		{domain.Errorf(domain.ErrConflict, "Busy."), `{"type":"/problems/conflict","title":"Conflict","status":409,"detail":"Busy.","instance":"/products/3","code":"conflict","request_id":"req-1"}`},
+		{domain.Errorf(domain.ErrUnauthorized, "Not authorized."), `{"type":"/problems/unauthorized","title":"Unauthorized","status":401,"detail":"Not authorized.","instance":"/products/3","code":"unauthorized","request_id":"req-1"}`},
+		{dto.ValidationErrors{{Field: "name", Code: dto.CodeRequired, Message: "must not be empty"}}, `{"type":"/problems/validation-failed","title":"Validation failed","status":422,"detail":"Invalid product data.","instance":"/products/3","code":"validation-failed","request_id":"req-1","errors":[{"field":"name","code":"required","message":"must not be empty"}]}`},
+		{errors.New("disk full"), `{"type":"/problems/internal","title":"Internal server error","status":500,"instance":"/products/3","code":"internal","request_id":"req-1"}`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/products/3", nil)
+		req.Header.Set(middleware.RequestIDHeader, "req-1")
+		w := httptest.NewRecorder()
+
+		middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.WriteError(w, r, tt.err)
+		})).ServeHTTP(w, req)
+
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"), tt.err.Error())
+		assert.JSONEq(t, tt.body, w.Body.String(), tt.err.Error())
+	}
+}
+
+func TestWriteValidation_UsesTheGivenDetail(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/auth/tokens", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+
+	middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.WriteValidation(w, r, "Invalid token request.", dto.ValidationErrors{{Field: "terminal_id", Code: dto.CodeRequired, Message: "must not be empty"}})
+	})).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{"type":"/problems/validation-failed","title":"Validation failed","status":422,"detail":"Invalid token request.","instance":"/auth/tokens","code":"validation-failed","request_id":"req-1","errors":[{"field":"terminal_id","code":"required","message":"must not be empty"}]}`, w.Body.String())
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"app/internal/domain"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// parseProductFilter reads conditions written as field[op]=value, or
+// field=value for equality, e.g. price[gte]=10&name[contains]=oat. A key may
+// repeat to add several conditions on one field. Conditions are ANDed, or
+// ORed with match=any. The older priceGt=value is read as price[gt]=value.
+func parseProductFilter(values url.Values) (f domain.ProductFilter, err error) {
+	switch values.Get("match") {
+	case "", "all":
+	case "any":
+		f.Any = true
+	default:
+		return f, errors.New("Invalid parameter match: expected all or any.")
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if key != "match" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, op := key, domain.FilterEq
+		if key == "priceGt" {
+			field, op = "price", domain.FilterGt
+		} else if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+			field, op = key[:i], domain.FilterOp(key[i+1:len(key)-1])
+		}
+
+		for _, raw := range values[key] {
+			c, err := domain.NewProductCondition(field, op, raw)
+			if err != nil {
+				return f, errors.New("Invalid filter " + key + ": " + err.Error() + ".")
+			}
+			f.Conditions = append(f.Conditions, c)
+		}
+	}
+
+	return f, nil
+}
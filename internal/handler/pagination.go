@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"app/internal/domain"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// pageCursor is the opaque position handed out in next links. It carries the
+// last product of the page, which the repository uses as a keyset bound, and
+// the sort it was taken under.
+type pageCursor struct {
+	Sort  string         `json:"sort"`
+	After domain.Product `json:"after"`
+}
+
+func encodeCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (c pageCursor, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		return c, errors.New("Invalid parameter cursor.")
+	}
+	return c, nil
+}
+
+// parsePageQuery reads limit, offset, sort and cursor from the query string.
+// Passing cursor, even empty for the first page, selects keyset pagination.
+func parsePageQuery(r *http.Request) (q domain.ProductPageQuery, byCursor bool, err error) {
+	values := r.URL.Query()
+
+	q.Limit = defaultPageLimit
+	if v := values.Get("limit"); v != "" {
+		q.Limit, err = strconv.Atoi(v)
+		if err != nil || q.Limit < 1 || q.Limit > maxPageLimit {
+			return q, false, errors.New("Invalid parameter limit: expected 1 to " + strconv.Itoa(maxPageLimit) + ".")
+		}
+	}
+
+	if v := values.Get("offset"); v != "" {
+		q.Offset, err = strconv.Atoi(v)
+		if err != nil || q.Offset < 0 {
+			return q, false, errors.New("Invalid parameter offset.")
+		}
+	}
+
+	q.Sort, err = domain.ParseProductSort(values.Get("sort"))
+	if err != nil {
+		return q, false, errors.New("Invalid parameter sort: " + err.Error() + ".")
+	}
+
+	if !values.Has("cursor") {
+		return q, false, nil
+	}
+	q.Offset = 0
+	if v := values.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			return q, true, err
+		}
+		if c.Sort != q.Sort.String() {
+			return q, true, errors.New("Invalid parameter cursor: it was issued for a different sort.")
+		}
+		q.After = &c.After
+	}
+
+	return q, true, nil
+}
+
+// pageLinks builds the next and prev links of a page. Offset pages link both
+// ways; cursor pages only forward, since a keyset cursor has no way back.
+func pageLinks(r *http.Request, q domain.ProductPageQuery, byCursor bool, page []domain.Product, hasMore bool) map[string]*string {
+	link := func(set func(v url.Values)) *string {
+		values := r.URL.Query()
+		values.Del("offset")
+		values.Del("cursor")
+		values.Set("limit", strconv.Itoa(q.Limit))
+		set(values)
+		u := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+		s := u.String()
+		return &s
+	}
+
+	links := map[string]*string{"next": nil, "prev": nil}
+
+	if hasMore && len(page) > 0 {
+		if byCursor {
+			cursor := encodeCursor(pageCursor{Sort: q.Sort.String(), After: page[len(page)-1]})
+			links["next"] = link(func(v url.Values) { v.Set("cursor", cursor) })
+		} else {
+			links["next"] = link(func(v url.Values) { v.Set("offset", strconv.Itoa(q.Offset+q.Limit)) })
+		}
+	}
+
+	if !byCursor && q.Offset > 0 {
+		links["prev"] = link(func(v url.Values) { v.Set("offset", strconv.Itoa(max(q.Offset-q.Limit, 0))) })
+	}
+
+	return links
+}
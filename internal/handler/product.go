@@ -4,9 +4,15 @@ import (
 	"app/internal"
 	"app/internal/domain"
 	"app/internal/dto"
+	"app/internal/problem"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bootcamp-go/web/request"
 	"github.com/bootcamp-go/web/response"
@@ -21,30 +27,38 @@ type ProductDefault struct {
 	sv internal.ProductService
 }
 
+// GetAll returns one page of the catalog. Pages are selected with limit and
+// offset, or with cursor (empty for the first page, then the one found in
+// the previous next link), and ordered by sort (e.g. sort=price,-name), ties
+// broken by id.
 func (h *ProductDefault) GetAll() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		q, byCursor, err := parsePageQuery(r)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
 
-		v, err := h.sv.FindAll()
+		// Ask for one extra product to learn whether a next page exists.
+		limit := q.Limit
+		q.Limit++
+		data, total, err := h.sv.FindPage(r.Context(), q)
+		q.Limit = limit
 		if err != nil {
-			response.JSON(w, http.StatusInternalServerError, nil)
+			WriteError(w, r, err)
 			return
 		}
 
-		data := make(map[int]domain.Product)
-		for key, value := range v {
-			data[key] = domain.Product{
-				Id:          value.Id,
-				Name:        value.Name,
-				Quantity:    value.Quantity,
-				CodeValue:   value.CodeValue,
-				IsPublished: value.IsPublished,
-				Expiration:  value.Expiration,
-				Price:       value.Price,
-			}
+		hasMore := len(data) > limit
+		if hasMore {
+			data = data[:limit]
 		}
+
 		response.JSON(w, http.StatusOK, map[string]any{
 			"message": "success",
 			"data":    data,
+			"total":   total,
+			"links":   pageLinks(r, q, byCursor, data, hasMore),
 		})
 	}
 }
@@ -54,19 +68,32 @@ func (h *ProductDefault) CreateProducts() http.HandlerFunc {
 		var requestBody dto.CreateRequestProducts
 
 		if err := request.JSON(r, &requestBody); err != nil {
-			response.Error(w, http.StatusBadRequest, err.Error())
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+
+		if errs := requestBody.Validate(); len(errs) > 0 {
+			WriteValidation(w, r, "Invalid product data.", errs)
 			return
 		}
 
-		err := h.sv.Create(requestBody.ToDomain())
+		prd, err := requestBody.ToDomain()
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+
+		data, err := h.sv.Create(r.Context(), prd)
 
 		if err != nil {
-			response.Error(w, http.StatusConflict, err.Error())
+			WriteError(w, r, err)
 			return
 		}
 
+		w.Header().Set("Location", "/products/"+strconv.Itoa(data.Id))
 		response.JSON(w, http.StatusCreated, map[string]any{
 			"message": "created",
+			"data":    data,
 		})
 	}
 }
@@ -77,14 +104,14 @@ func (h *ProductDefault) GetProductById() http.HandlerFunc {
 		id, err := strconv.Atoi(idStr)
 
 		if err != nil {
-			response.Error(w, http.StatusBadRequest, "Malformed or incomplete product data.")
+			problem.Write(w, r, problem.BadRequest, "Malformed or incomplete product data.")
 			return
 		}
 
-		data, err := h.sv.GetById(id)
+		data, err := h.sv.GetById(r.Context(), id)
 
 		if err != nil {
-			response.Error(w, http.StatusNotFound, err.Error())
+			WriteError(w, r, err)
 			return
 		}
 
@@ -95,23 +122,135 @@ func (h *ProductDefault) GetProductById() http.HandlerFunc {
 	}
 }
 
+func (h *ProductDefault) GetProductByCodeValue() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := chi.URLParam(r, "code_value")
+
+		data, err := h.sv.GetByCodeValue(r.Context(), code)
+
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    data,
+		})
+	}
+}
+
+// SearchProducts returns the products matching the filter in the query
+// string; see parseProductFilter for the syntax.
 func (h *ProductDefault) SearchProducts() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		priceGtStr := r.URL.Query().Get("priceGt")
+		filter, err := parseProductFilter(r.URL.Query())
+
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+
+		if len(filter.Conditions) == 0 {
+			problem.Write(w, r, problem.BadRequest, "Missing filter parameters, e.g. price[gt]=10.")
+			return
+		}
+
+		data, err := h.sv.FindProducts(r.Context(), filter)
+
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    data,
+		})
+	}
+}
+
+const (
+	defaultTextSearchLimit = 20
+	maxTextSearchLimit     = 100
+)
+
+// SearchProductsText ranks products by how well their name matches q. Words
+// may be fragments, so it also serves typeahead.
+func (h *ProductDefault) SearchProductsText() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			problem.Write(w, r, problem.BadRequest, "Missing parameter q")
+			return
+		}
+
+		limit := defaultTextSearchLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			var err error
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > maxTextSearchLimit {
+				problem.Write(w, r, problem.BadRequest, "Invalid parameter limit: expected 1 to "+strconv.Itoa(maxTextSearchLimit)+".")
+				return
+			}
+		}
+
+		data, err := h.sv.SearchText(r.Context(), q, limit)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    data,
+		})
+	}
+}
+
+func (h *ProductDefault) GetExpiringProducts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		asOf, err := parseAsOf(r)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+
+		days := 7
+		if within := r.URL.Query().Get("within"); within != "" {
+			days, err = parseDays(within)
+			if err != nil {
+				problem.Write(w, r, problem.BadRequest, err.Error())
+				return
+			}
+		}
 
-		if priceGtStr == "" {
-			response.Error(w, http.StatusBadRequest, "Missing parameter priceGt")
+		data, err := h.sv.FindExpiring(r.Context(), asOf, days)
+		if err != nil {
+			WriteError(w, r, err)
 			return
 		}
 
-		priceGt, err := strconv.ParseFloat(priceGtStr, 64)
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    data,
+		})
+	}
+}
 
+func (h *ProductDefault) GetExpiredProducts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		asOf, err := parseAsOf(r)
 		if err != nil {
-			response.Error(w, http.StatusBadRequest, err.Error())
+			problem.Write(w, r, problem.BadRequest, err.Error())
 			return
 		}
 
-		data, err := h.sv.FindProducts(priceGt)
+		data, err := h.sv.FindExpired(r.Context(), asOf)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
 
 		response.JSON(w, http.StatusOK, map[string]any{
 			"message": "success",
@@ -120,6 +259,34 @@ func (h *ProductDefault) SearchProducts() http.HandlerFunc {
 	}
 }
 
+// parseAsOf reads the optional as_of query parameter, defaulting to today.
+func parseAsOf(r *http.Request) (domain.Date, error) {
+	asOf := r.URL.Query().Get("as_of")
+	if asOf == "" {
+		return domain.DateOf(time.Now()), nil
+	}
+	return domain.ParseDate(asOf)
+}
+
+// parseDays accepts a number of days written as "7", "7d" or "2w".
+func parseDays(s string) (int, error) {
+	unit := 1
+	switch {
+	case strings.HasSuffix(s, "d"):
+		s = strings.TrimSuffix(s, "d")
+	case strings.HasSuffix(s, "w"):
+		s = strings.TrimSuffix(s, "w")
+		unit = 7
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, errors.New("Invalid parameter within: expected days such as 7d or 2w.")
+	}
+
+	return n * unit, nil
+}
+
 func (h *ProductDefault) UpdateProduct() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		idStr := chi.URLParam(r, "id_product")
@@ -127,20 +294,32 @@ func (h *ProductDefault) UpdateProduct() http.HandlerFunc {
 		id, err := strconv.Atoi(idStr)
 
 		if err != nil {
-			response.Error(w, http.StatusBadRequest, err.Error())
+			problem.Write(w, r, problem.BadRequest, err.Error())
 			return
 		}
 
 		var input dto.CreateRequestProducts
-		json.NewDecoder(r.Body).Decode(&input)
+		if err := request.JSON(r, &input); err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
 
-		prd := input.ToDomain()
+		if errs := input.Validate(); len(errs) > 0 {
+			WriteValidation(w, r, "Invalid product data.", errs)
+			return
+		}
+
+		prd, err := input.ToDomain()
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
 		prd.Id = id
 
-		data, err := h.sv.UpdateById(id, prd)
+		data, err := h.sv.UpdateById(r.Context(), id, prd)
 
 		if err != nil {
-			response.Error(w, http.StatusNotFound, err.Error())
+			WriteError(w, r, err)
 			return
 		}
 
@@ -151,26 +330,37 @@ func (h *ProductDefault) UpdateProduct() http.HandlerFunc {
 	}
 }
 
+// UpdateProductAttributes applies a partial update. The body format follows
+// the Content-Type: a plain JSON object, an RFC 7396 merge patch or an
+// RFC 6902 JSON Patch document.
 func (h *ProductDefault) UpdateProductAttributes() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		idStr := chi.URLParam(r, "id_product")
 		id, err := strconv.Atoi(idStr)
 
 		if err != nil {
-			response.Error(w, http.StatusBadRequest, err.Error())
+			problem.Write(w, r, problem.BadRequest, err.Error())
 			return
 		}
 
-		var input dto.CreateRequestProducts
-		json.NewDecoder(r.Body).Decode(&input)
+		patch, err := decodePatch(r)
 
-		prd := input.ToDomain()
-		prd.Id = id
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			problem.Write(w, r, problem.UnsupportedMediaType, err.Error())
+			return
+		case errors.Is(err, domain.ErrValidation):
+			WriteError(w, r, err)
+			return
+		case err != nil:
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
 
-		data, err := h.sv.UpdateById(id, prd)
+		data, err := h.sv.UpdateAttributesById(r.Context(), id, patch)
 
 		if err != nil {
-			response.Error(w, http.StatusNotFound, err.Error())
+			WriteError(w, r, err)
 			return
 		}
 
@@ -181,20 +371,57 @@ func (h *ProductDefault) UpdateProductAttributes() http.HandlerFunc {
 	}
 }
 
+var errUnsupportedMediaType = errors.New("Unsupported Content-Type: use application/json, " + dto.MergePatchContentType + " or " + dto.JSONPatchContentType + ".")
+
+func decodePatch(r *http.Request) (domain.ProductPatcher, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, errUnsupportedMediaType
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case dto.JSONPatchContentType:
+		return dto.DecodeJSONPatch(body)
+	case "application/json", dto.MergePatchContentType:
+		var input dto.PatchRequestProducts
+		if mediaType == dto.MergePatchContentType {
+			input, err = dto.DecodeMergePatch(body)
+		} else {
+			err = json.Unmarshal(body, &input)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if errs := input.Validate(); len(errs) > 0 {
+			return nil, errs
+		}
+
+		return input.ToDomain()
+	default:
+		return nil, errUnsupportedMediaType
+	}
+}
+
 func (h *ProductDefault) DeleteProduct() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		idStr := chi.URLParam(r, "id_product")
 		id, err := strconv.Atoi(idStr)
 
 		if err != nil {
-			response.Error(w, http.StatusBadRequest, err.Error())
+			problem.Write(w, r, problem.BadRequest, err.Error())
 			return
 		}
 
-		err = h.sv.DeleteById(id)
+		err = h.sv.DeleteById(r.Context(), id)
 
 		if err != nil {
-			response.Error(w, http.StatusNotFound, err.Error())
+			WriteError(w, r, err)
 			return
 		}
 
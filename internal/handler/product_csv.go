@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"app/internal/domain"
+	"app/internal/loader"
+	"app/internal/logging"
+	"app/internal/problem"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/bootcamp-go/web/response"
+)
+
+const (
+	// exportPageSize is how many products ExportProducts reads at a time.
+	exportPageSize = 500
+	// maxImportBytes bounds the size of an uploaded catalog.
+	maxImportBytes = 10 << 20
+)
+
+// ExportProducts streams the whole catalog ordered by id. format must be
+// csv, the default. The catalog is read a page at a time, so a product
+// changed during the export shows either its old or its new state.
+func (h *ProductDefault) ExportProducts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+			problem.Write(w, r, problem.BadRequest, fmt.Sprintf("Unsupported format %q: expected csv.", format))
+			return
+		}
+
+		q := domain.ProductPageQuery{Limit: exportPageSize}
+		page, _, err := h.sv.FindPage(r.Context(), q)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+		w.WriteHeader(http.StatusOK)
+
+		cw := loader.NewProductCSVWriter(w)
+		flusher, _ := w.(http.Flusher)
+		for {
+			for _, p := range page {
+				cw.Write(p)
+			}
+			if err = cw.Flush(); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			if len(page) < exportPageSize {
+				return
+			}
+
+			q.After = &page[len(page)-1]
+			if page, _, err = h.sv.FindPage(r.Context(), q); err != nil {
+				// The status is sent; cut the response short so the client
+				// sees a failed transfer rather than a truncated catalog.
+				logging.FromContext(r.Context()).Error("export failed", "error", err)
+				panic(http.ErrAbortHandler)
+			}
+		}
+	}
+}
+
+var errUnsupportedImportType = errors.New("Unsupported Content-Type: use text/csv or multipart/form-data with a file part.")
+
+// ImportProducts creates or replaces the products of an uploaded CSV: rows
+// with an id replace that product, rows without one are created. Every row
+// is checked first and nothing is imported unless all pass; with
+// dry_run=true the report of what would happen is returned either way.
+// columns maps spreadsheet titles to fields, e.g. columns=SKU:code_value.
+func (h *ProductDefault) ImportProducts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dryRun := false
+		if s := r.URL.Query().Get("dry_run"); s != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(s); err != nil {
+				problem.Write(w, r, problem.BadRequest, "Invalid parameter dry_run: expected true or false.")
+				return
+			}
+		}
+
+		header, err := loader.ParseCSVHeader(r.URL.Query().Get("columns"))
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, "Invalid parameter columns: "+err.Error()+".")
+			return
+		}
+
+		body, err := importBody(w, r)
+		if err != nil {
+			if errors.Is(err, errUnsupportedImportType) {
+				problem.Write(w, r, problem.UnsupportedMediaType, err.Error())
+				return
+			}
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+		defer body.Close()
+
+		rows, rowErrs, err := readImport(body, header)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest, err.Error())
+			return
+		}
+
+		report, err := h.sv.Import(r.Context(), rows, dryRun || len(rowErrs) > 0)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		report.DryRun = dryRun
+		report.Rows += len(rowErrs)
+		if len(rowErrs) > 0 {
+			report.Errors = append(report.Errors, rowErrs...)
+			sort.SliceStable(report.Errors, func(i, j int) bool {
+				return report.Errors[i].Line < report.Errors[j].Line
+			})
+		}
+
+		switch {
+		case dryRun:
+			response.JSON(w, http.StatusOK, map[string]any{
+				"message": "dry run",
+				"data":    report,
+			})
+		case len(report.Errors) > 0:
+			p := problem.New(r, problem.ValidationFailed, fmt.Sprintf("%d of %d rows are invalid; nothing was imported.", invalidRows(report.Errors), report.Rows))
+			p.Errors = report.Errors
+			p.Write(w)
+		default:
+			response.JSON(w, http.StatusOK, map[string]any{
+				"message": "imported",
+				"data":    report,
+			})
+		}
+	}
+}
+
+// importBody returns the CSV of the request, sent as the body itself or as
+// the file part of a form.
+func importBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, errUnsupportedImportType
+	}
+
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return r.Body, nil
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid upload: %w.", err)
+		}
+		return file, nil
+	default:
+		return nil, errUnsupportedImportType
+	}
+}
+
+// readImport reads every row, keeping those that parsed and valid and
+// turning the problems of the others into row errors.
+func readImport(body io.Reader, header loader.CSVHeader) (rows []domain.ProductImportRow, rowErrs []domain.ProductImportError, err error) {
+	cr, err := loader.NewProductCSVReader(body, header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid CSV: %w.", err)
+	}
+
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, rowErrs, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid CSV: %w.", err)
+		}
+
+		for _, e := range row.Errors {
+			rowErrs = append(rowErrs, domain.ProductImportError{Line: row.Line, Field: e.Field, Code: e.Code, Message: e.Message})
+		}
+		if len(row.Errors) == 0 {
+			rows = append(rows, domain.ProductImportRow{Line: row.Line, Product: row.Product})
+		}
+	}
+}
+
+func invalidRows(errs []domain.ProductImportError) int {
+	lines := make(map[int]bool, len(errs))
+	for _, e := range errs {
+		lines[e.Line] = true
+	}
+	return len(lines)
+}
@@ -0,0 +1,182 @@
+package handler_test
+
+import (
+	"app/internal/domain"
+	"app/internal/handler"
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportProducts_StreamsEveryPage(t *testing.T) {
+	var queries []domain.ProductPageQuery
+	mockSvc := &mockProductService{
+		FindPageFunc: func(q domain.ProductPageQuery) ([]domain.Product, int, error) {
+			queries = append(queries, q)
+			start := 1
+			if q.After != nil {
+				start = q.After.Id + 1
+			}
+			var page []domain.Product
+			for id := start; id <= 501 && len(page) < q.Limit; id++ {
+				page = append(page, domain.Product{Id: id, Name: "P" + strconv.Itoa(id), Price: 1})
+			}
+			return page, 501, nil
+		},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/products/export?format=csv", nil)
+	w := httptest.NewRecorder()
+
+	handler.NewProductDefault(mockSvc).ExportProducts().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "products.csv")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 502)
+	assert.Equal(t, "id,name,quantity,code_value,is_published,expiration,price", lines[0])
+	assert.Equal(t, "501,P501,0,,false,,1", lines[501])
+	require.Len(t, queries, 2)
+	assert.Equal(t, 500, queries[1].After.Id)
+}
+
+func TestExportProducts_Errors(t *testing.T) {
+	mockSvc := &mockProductService{
+		FindPageFunc: func(q domain.ProductPageQuery) ([]domain.Product, int, error) {
+			return nil, 0, errors.New("boom")
+		},
+	}
+	h := handler.NewProductDefault(mockSvc).ExportProducts()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/export?format=xlsx", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/export", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+}
+
+const importCSV = "id,name,quantity,price\n" +
+	"1,Milk,3,1.25\n" +
+	",Tea,x,2\n" +
+	",Bread,1,2\n"
+
+func TestImportProducts_DryRunReportsEveryRow(t *testing.T) {
+	var got []domain.ProductImportRow
+	mockSvc := &mockProductService{
+		ImportFunc: func(rows []domain.ProductImportRow, dryRun bool) (domain.ProductImportReport, error) {
+			got = rows
+			assert.True(t, dryRun)
+			return domain.ProductImportReport{DryRun: true, Rows: 2, Created: 1, Errors: []domain.ProductImportError{
+				{Line: 2, Field: "id", Code: domain.ImportCodeNotFound, Message: "Product 1 not found."},
+			}}, nil
+		},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/products/import?dry_run=true", strings.NewReader(importCSV))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+
+	handler.NewProductDefault(mockSvc).ImportProducts().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"message": "dry run",
+		"data": {
+			"dry_run": true,
+			"rows": 3,
+			"created": 1,
+			"updated": 0,
+			"errors": [
+				{"line": 2, "field": "id", "code": "not_found", "message": "Product 1 not found."},
+				{"line": 3, "field": "quantity", "code": "invalid_number", "message": "\"x\" is not an integer"}
+			]
+		}
+	}`, w.Body.String())
+	require.Len(t, got, 2)
+	assert.Equal(t, 4, got[1].Line)
+	assert.Equal(t, "Bread", got[1].Product.Name)
+}
+
+func TestImportProducts_RejectsWhenAnyRowFails(t *testing.T) {
+	mockSvc := &mockProductService{
+		ImportFunc: func(rows []domain.ProductImportRow, dryRun bool) (domain.ProductImportReport, error) {
+			assert.True(t, dryRun, "nothing is committed with invalid rows")
+			return domain.ProductImportReport{DryRun: true, Rows: len(rows), Errors: []domain.ProductImportError{}}, nil
+		},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/products/import", strings.NewReader(importCSV))
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	w := httptest.NewRecorder()
+
+	handler.NewProductDefault(mockSvc).ImportProducts().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"detail":"1 of 3 rows are invalid; nothing was imported."`)
+	assert.Contains(t, w.Body.String(), `"line":3`)
+}
+
+func TestImportProducts_MultipartUpload(t *testing.T) {
+	mockSvc := &mockProductService{
+		ImportFunc: func(rows []domain.ProductImportRow, dryRun bool) (domain.ProductImportReport, error) {
+			assert.False(t, dryRun)
+			require.Len(t, rows, 1)
+			assert.Equal(t, "M1", rows[0].Product.CodeValue)
+			return domain.ProductImportReport{Rows: 1, Created: 1, Errors: []domain.ProductImportError{}}, nil
+		},
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "catalog.csv")
+	require.NoError(t, err)
+	part.Write([]byte("Name,SKU,Price\nMilk,M1,1.25\n"))
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/products/import?columns=SKU:code_value", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	handler.NewProductDefault(mockSvc).ImportProducts().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"message":"imported"`)
+	assert.Contains(t, w.Body.String(), `"created":1`)
+}
+
+func TestImportProducts_BadRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"json body", "", "application/json", `[]`, http.StatusUnsupportedMediaType},
+		{"bad dry_run", "?dry_run=maybe", "text/csv", importCSV, http.StatusBadRequest},
+		{"bad columns", "?columns=SKU", "text/csv", importCSV, http.StatusBadRequest},
+		{"unknown mapped field", "?columns=SKU:sku", "text/csv", importCSV, http.StatusBadRequest},
+		{"missing price column", "", "text/csv", "name\nMilk\n", http.StatusBadRequest},
+		{"malformed csv", "", "text/csv", "name,price\n\"Milk,1\n", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/products/import"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			handler.NewProductDefault(&mockProductService{}).ImportProducts().ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		})
+	}
+}
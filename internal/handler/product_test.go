@@ -12,6 +12,7 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
@@ -19,66 +20,109 @@ import (
 
 type mockProductService struct {
 	FindAllFunc              func() (map[int]domain.Product, error)
-	CreateFunc               func(p domain.Product) (err error)
+	FindPageFunc             func(q domain.ProductPageQuery) ([]domain.Product, int, error)
+	CreateFunc               func(p domain.Product) (domain.Product, error)
 	GetByIdFunc              func(id int) (p domain.Product, err error)
-	FindProductsFunc         func(price float64) (p map[int]domain.Product, err error)
+	GetByCodeValueFunc       func(code string) (p domain.Product, err error)
+	FindProductsFunc         func(f domain.ProductFilter) ([]domain.Product, error)
+	SearchTextFunc           func(q string, limit int) ([]domain.ProductMatch, error)
+	FindExpiringFunc         func(asOf domain.Date, days int) ([]domain.Product, error)
+	FindExpiredFunc          func(asOf domain.Date) ([]domain.Product, error)
 	UpdateByIdFunc           func(id int, pr domain.Product) (p domain.Product, e error)
-	UpdateAttributesByIdFunc func(id int, pr domain.Product) (p domain.Product, e error)
+	UpdateAttributesByIdFunc func(id int, pr domain.ProductPatcher) (p domain.Product, e error)
 	DeleteByIdFunc           func(id int) (err error)
+	ImportFunc               func(rows []domain.ProductImportRow, dryRun bool) (domain.ProductImportReport, error)
 }
 
-func (m *mockProductService) Create(p domain.Product) error {
-	return nil
+func (m *mockProductService) Create(ctx context.Context, p domain.Product) (domain.Product, error) {
+	if m.CreateFunc != nil {
+		return m.CreateFunc(p)
+	}
+	return domain.Product{}, nil
+}
+
+func (m *mockProductService) GetById(ctx context.Context, id int) (domain.Product, error) {
+	return domain.Product{}, nil
 }
 
-func (m *mockProductService) GetById(id int) (domain.Product, error) {
+func (m *mockProductService) GetByCodeValue(ctx context.Context, code string) (domain.Product, error) {
+	if m.GetByCodeValueFunc != nil {
+		return m.GetByCodeValueFunc(code)
+	}
 	return domain.Product{}, nil
 }
 
-func (m *mockProductService) DeleteById(id int) error {
+func (m *mockProductService) DeleteById(ctx context.Context, id int) error {
+	if m.DeleteByIdFunc != nil {
+		return m.DeleteByIdFunc(id)
+	}
 	return nil
 }
 
-func (m *mockProductService) UpdateById(id int, p domain.Product) (domain.Product, error) {
+func (m *mockProductService) UpdateById(ctx context.Context, id int, p domain.Product) (domain.Product, error) {
 	return domain.Product{}, nil
 }
 
-func (m *mockProductService) FindProducts(price float64) (map[int]domain.Product, error) {
-	products := map[int]domain.Product{
-		1: {Id: 1, Name: "Product 1", Price: 100.0},
-		2: {Id: 2, Name: "Product 2", Price: 200.0},
+func (m *mockProductService) FindProducts(ctx context.Context, f domain.ProductFilter) ([]domain.Product, error) {
+	if m.FindProductsFunc != nil {
+		return m.FindProductsFunc(f)
+	}
+
+	products := []domain.Product{
+		{Id: 1, Name: "Product 1", Price: 100.0},
+		{Id: 2, Name: "Product 2", Price: 200.0},
 	}
 
-	filteredProducts := make(map[int]domain.Product)
-	for id, product := range products {
-		if product.Price >= price {
-			filteredProducts[id] = product
+	filteredProducts := make([]domain.Product, 0)
+	for _, product := range products {
+		if f.Match(product) {
+			filteredProducts = append(filteredProducts, product)
 		}
 	}
 
 	return filteredProducts, nil
 }
 
-func (m *mockProductService) FindAll() (map[int]domain.Product, error) {
+func (m *mockProductService) SearchText(ctx context.Context, q string, limit int) ([]domain.ProductMatch, error) {
+	return m.SearchTextFunc(q, limit)
+}
+
+func (m *mockProductService) FindExpiring(ctx context.Context, asOf domain.Date, days int) ([]domain.Product, error) {
+	return m.FindExpiringFunc(asOf, days)
+}
+
+func (m *mockProductService) FindExpired(ctx context.Context, asOf domain.Date) ([]domain.Product, error) {
+	return m.FindExpiredFunc(asOf)
+}
+
+func (m *mockProductService) FindAll(ctx context.Context) (map[int]domain.Product, error) {
 	return m.FindAllFunc()
 }
 
-func (m *mockProductService) UpdateAttributesById(id int, p domain.Product) (domain.Product, error) {
+func (m *mockProductService) FindPage(ctx context.Context, q domain.ProductPageQuery) ([]domain.Product, int, error) {
+	return m.FindPageFunc(q)
+}
+
+func (m *mockProductService) UpdateAttributesById(ctx context.Context, id int, p domain.ProductPatcher) (domain.Product, error) {
 	if m.UpdateAttributesByIdFunc != nil {
 		return m.UpdateAttributesByIdFunc(id, p)
 	}
 	return domain.Product{}, nil
 }
 
+func (m *mockProductService) Import(ctx context.Context, rows []domain.ProductImportRow, dryRun bool) (domain.ProductImportReport, error) {
+	return m.ImportFunc(rows, dryRun)
+}
+
 func TestGetAll_Success(t *testing.T) {
-	mockProducts := map[int]domain.Product{
-		1: {Id: 1, Name: "Produto 1", Quantity: 3, CodeValue: "123", IsPublished: true, Expiration: "2025-01-01", Price: 10.0},
-		2: {Id: 2, Name: "Produto 2", Quantity: 5, CodeValue: "456", IsPublished: false, Expiration: "2025-06-01", Price: 20.0},
+	mockProducts := []domain.Product{
+		{Id: 1, Name: "Produto 1", Quantity: 3, CodeValue: "123", IsPublished: true, Expiration: domain.NewDate(2025, time.January, 1), Price: 10.0},
+		{Id: 2, Name: "Produto 2", Quantity: 5, CodeValue: "456", IsPublished: false, Expiration: domain.NewDate(2025, time.June, 1), Price: 20.0},
 	}
 
 	mockSvc := &mockProductService{
-		FindAllFunc: func() (map[int]domain.Product, error) {
-			return mockProducts, nil
+		FindPageFunc: func(q domain.ProductPageQuery) ([]domain.Product, int, error) {
+			return mockProducts, 2, nil
 		},
 	}
 	pHandler := handler.NewProductDefault(mockSvc)
@@ -89,12 +133,94 @@ func TestGetAll_Success(t *testing.T) {
 	pHandler.GetAll().ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"message": "success",
+		"data": [
+			{"id":1,"name":"Produto 1","quantity":3,"code_value":"123","is_published":true,"expiration":"01/01/2025","price":10},
+			{"id":2,"name":"Produto 2","quantity":5,"code_value":"456","is_published":false,"expiration":"01/06/2025","price":20}
+		],
+		"total": 2,
+		"links": {"next": null, "prev": null}
+	}`, w.Body.String())
+}
+
+func TestGetAll_OffsetPagination(t *testing.T) {
+	mockSvc := &mockProductService{
+		FindPageFunc: func(q domain.ProductPageQuery) ([]domain.Product, int, error) {
+			assert.Equal(t, 3, q.Limit)
+			assert.Equal(t, 2, q.Offset)
+			assert.Equal(t, domain.ProductSort{{Field: "price"}, {Field: "name", Desc: true}}, q.Sort)
+			return []domain.Product{{Id: 3}, {Id: 4}, {Id: 5}}, 10, nil
+		},
+	}
+	pHandler := handler.NewProductDefault(mockSvc)
+
+	req := httptest.NewRequest(http.MethodGet, "/products?limit=2&offset=2&sort=price,-name", nil)
+	w := httptest.NewRecorder()
+
+	pHandler.GetAll().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data  []domain.Product   `json:"data"`
+		Total int                `json:"total"`
+		Links map[string]*string `json:"links"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Data, 2)
+	assert.Equal(t, 10, resp.Total)
+	assert.Equal(t, "/products?limit=2&offset=4&sort=price%2C-name", *resp.Links["next"])
+	assert.Equal(t, "/products?limit=2&offset=0&sort=price%2C-name", *resp.Links["prev"])
+}
+
+func TestGetAll_CursorPagination(t *testing.T) {
+	var calls int
+	mockSvc := &mockProductService{
+		FindPageFunc: func(q domain.ProductPageQuery) ([]domain.Product, int, error) {
+			calls++
+			if calls == 1 {
+				return []domain.Product{{Id: 1}, {Id: 2}, {Id: 3}}, 3, nil
+			}
+			assert.NotNil(t, q.After)
+			assert.Equal(t, 2, q.After.Id)
+			return []domain.Product{{Id: 3}}, 3, nil
+		},
+	}
+	pHandler := handler.NewProductDefault(mockSvc)
+
+	w := httptest.NewRecorder()
+	pHandler.GetAll().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products?limit=2&cursor=", nil))
+
+	var resp struct {
+		Links map[string]*string `json:"links"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotNil(t, resp.Links["next"])
+
+	w = httptest.NewRecorder()
+	pHandler.GetAll().ServeHTTP(w, httptest.NewRequest(http.MethodGet, *resp.Links["next"], nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Nil(t, resp.Links["next"])
+	assert.Nil(t, resp.Links["prev"])
+}
+
+func TestGetAll_InvalidSort(t *testing.T) {
+	pHandler := handler.NewProductDefault(&mockProductService{})
+
+	req := httptest.NewRequest(http.MethodGet, "/products?sort=colour", nil)
+	w := httptest.NewRecorder()
+
+	pHandler.GetAll().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
 func TestGetAll_Failure(t *testing.T) {
 	mockSvc := &mockProductService{
-		FindAllFunc: func() (map[int]domain.Product, error) {
-			return nil, errors.New("database failure")
+		FindPageFunc: func(q domain.ProductPageQuery) ([]domain.Product, int, error) {
+			return nil, 0, errors.New("database failure")
 		},
 	}
 	pHandler := handler.NewProductDefault(mockSvc)
@@ -109,8 +235,9 @@ func TestGetAll_Failure(t *testing.T) {
 
 func TestCreateProducts_Success(t *testing.T) {
 	mockService := &mockProductService{
-		CreateFunc: func(p domain.Product) error {
-			return nil
+		CreateFunc: func(p domain.Product) (domain.Product, error) {
+			p.Id = 501
+			return p, nil
 		},
 	}
 
@@ -140,6 +267,8 @@ func TestCreateProducts_Success(t *testing.T) {
 	err = json.Unmarshal(rr.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
 	assert.Equal(t, "created", respBody["message"])
+	assert.Equal(t, "/products/501", rr.Header().Get("Location"))
+	assert.Equal(t, float64(501), respBody["data"].(map[string]interface{})["id"])
 }
 
 func TestCreateProducts_BadRequest(t *testing.T) {
@@ -156,6 +285,51 @@ func TestCreateProducts_BadRequest(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
+func TestCreateProducts_ValidationErrors(t *testing.T) {
+	mockService := &mockProductService{}
+
+	h := handler.NewProductDefault(mockService)
+
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBufferString(`{"name":" ","quantity":-1,"price":0}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	h.CreateProducts().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.JSONEq(t, `{
+		"type": "/problems/validation-failed",
+		"title": "Validation failed",
+		"status": 422,
+		"detail": "Invalid product data.",
+		"instance": "/products",
+		"code": "validation-failed",
+		"errors": [
+			{"field": "name", "code": "required", "message": "must not be empty"},
+			{"field": "quantity", "code": "negative", "message": "must not be negative"},
+			{"field": "price", "code": "not_positive", "message": "must be greater than zero"}
+		]
+	}`, rr.Body.String())
+}
+
+func TestCreateProducts_InvalidExpiration(t *testing.T) {
+	mockService := &mockProductService{}
+
+	h := handler.NewProductDefault(mockService)
+
+	bodyBytes, err := json.Marshal(dto.CreateRequestProducts{Name: "Test Product", Price: 1, Expiration: "31/02/2025"})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	h.CreateProducts().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"field":"expiration","code":"invalid_date"`)
+}
+
 func TestGetProductById_Success(t *testing.T) {
 	mockProduct := domain.Product{
 		Id:          1,
@@ -163,7 +337,7 @@ func TestGetProductById_Success(t *testing.T) {
 		Quantity:    10,
 		CodeValue:   "ABC123",
 		IsPublished: true,
-		Expiration:  "2025-01-01",
+		Expiration:  domain.NewDate(2025, time.January, 1),
 		Price:       99.99,
 	}
 
@@ -204,25 +378,54 @@ func TestGetProductById_BadRequest(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
-func TestSearchProducts_Success(t *testing.T) {
-	mockProducts := []domain.Product{
-		{Id: 1, Name: "Produto A", Price: 10.5},
-		{Id: 2, Name: "Produto B", Price: 20.0},
+func TestGetProductByCodeValue_Success(t *testing.T) {
+	mockSvc := &mockProductService{
+		GetByCodeValueFunc: func(code string) (domain.Product, error) {
+			assert.Equal(t, "S82254D", code)
+			return domain.Product{Id: 1, CodeValue: code}, nil
+		},
 	}
 
+	h := handler.NewProductDefault(mockSvc)
+
+	req := httptest.NewRequest(http.MethodGet, "/products/code/S82254D", nil)
+	w := httptest.NewRecorder()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("code_value", "S82254D")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	h.GetProductByCodeValue().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGetProductByCodeValue_NotFound(t *testing.T) {
 	mockSvc := &mockProductService{
-		FindProductsFunc: func(price float64) (map[int]domain.Product, error) {
-			assert.Equal(t, 10.0, price)
-			result := make(map[int]domain.Product)
-			for i, p := range mockProducts {
-				result[i+1] = p
-			}
-			return result, nil
+		GetByCodeValueFunc: func(code string) (domain.Product, error) {
+			return domain.Product{}, domain.Errorf(domain.ErrNotFound, "Code value %s not found.", code)
 		},
 	}
 
 	h := handler.NewProductDefault(mockSvc)
 
+	req := httptest.NewRequest(http.MethodGet, "/products/code/NOPE", nil)
+	w := httptest.NewRecorder()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("code_value", "NOPE")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	h.GetProductByCodeValue().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSearchProducts_Success(t *testing.T) {
+	mockSvc := &mockProductService{}
+
+	h := handler.NewProductDefault(mockSvc)
+
 	req := httptest.NewRequest(http.MethodGet, "/products/search?priceGt=10.0", nil)
 	w := httptest.NewRecorder()
 
@@ -234,6 +437,52 @@ func TestSearchProducts_Success(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &resp)
 	assert.NoError(t, err)
 	assert.Equal(t, "success", resp["message"])
+	assert.Len(t, resp["data"], 2)
+}
+
+func TestSearchProducts_CombinedFilters(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+
+	tests := []struct {
+		query string
+		ids   []float64
+	}{
+		{"price[gte]=100&price[lt]=200", []float64{1}},
+		{"price[gt]=150&name[contains]=product", []float64{2}},
+		{"match=any&price[lt]=150&name[prefix]=PRODUCT%202", []float64{1, 2}},
+		{"price[gt]=500", []float64{}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/products/search?"+tt.query, nil)
+		w := httptest.NewRecorder()
+
+		h.SearchProducts().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tt.query)
+		var resp struct {
+			Data []map[string]any `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotNil(t, resp.Data, tt.query)
+		ids := make([]float64, 0)
+		for _, p := range resp.Data {
+			ids = append(ids, p["id"].(float64))
+		}
+		assert.Equal(t, tt.ids, ids, tt.query)
+	}
+}
+
+func TestSearchProducts_InvalidFilter(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+
+	for _, query := range []string{"colour=red", "is_published[gt]=true", "expiration[lt]=31/02/2021", "match=some&price=1"} {
+		req := httptest.NewRequest(http.MethodGet, "/products/search?"+query, nil)
+		w := httptest.NewRecorder()
+
+		h.SearchProducts().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
 }
 
 func TestSearchProducts_MissingPriceGt(t *testing.T) {
@@ -260,6 +509,83 @@ func TestSearchProducts_InvalidPriceGt(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestSearchProductsText_Success(t *testing.T) {
+	mockSvc := &mockProductService{
+		SearchTextFunc: func(q string, limit int) ([]domain.ProductMatch, error) {
+			assert.Equal(t, "oat cookie", q)
+			assert.Equal(t, 5, limit)
+			return []domain.ProductMatch{{Product: domain.Product{Id: 4, Name: "Cookie - Oatmeal"}, Score: 1.5}}, nil
+		},
+	}
+	h := handler.NewProductDefault(mockSvc)
+
+	req := httptest.NewRequest(http.MethodGet, "/products/search/text?q=oat+cookie&limit=5", nil)
+	w := httptest.NewRecorder()
+
+	h.SearchProductsText().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message":"success","data":[{"id":4,"name":"Cookie - Oatmeal","quantity":0,"code_value":"","is_published":false,"expiration":"","price":0,"score":1.5}]}`, w.Body.String())
+}
+
+func TestSearchProductsText_MissingQuery(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+
+	req := httptest.NewRequest(http.MethodGet, "/products/search/text?q=+", nil)
+	w := httptest.NewRecorder()
+
+	h.SearchProductsText().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetExpiringProducts_Success(t *testing.T) {
+	mockSvc := &mockProductService{
+		FindExpiringFunc: func(asOf domain.Date, days int) ([]domain.Product, error) {
+			assert.Equal(t, domain.NewDate(2021, time.December, 10), asOf)
+			assert.Equal(t, 14, days)
+			return []domain.Product{{Id: 1, Expiration: domain.NewDate(2021, time.December, 15)}}, nil
+		},
+	}
+	h := handler.NewProductDefault(mockSvc)
+
+	req := httptest.NewRequest(http.MethodGet, "/products/expiring?within=2w&as_of=10/12/2021", nil)
+	w := httptest.NewRecorder()
+
+	h.GetExpiringProducts().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message":"success","data":[{"id":1,"name":"","quantity":0,"code_value":"","is_published":false,"expiration":"15/12/2021","price":0}]}`, w.Body.String())
+}
+
+func TestGetExpiringProducts_InvalidWithin(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+
+	req := httptest.NewRequest(http.MethodGet, "/products/expiring?within=soon", nil)
+	w := httptest.NewRecorder()
+
+	h.GetExpiringProducts().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetExpiredProducts_DefaultsToToday(t *testing.T) {
+	mockSvc := &mockProductService{
+		FindExpiredFunc: func(asOf domain.Date) ([]domain.Product, error) {
+			assert.Equal(t, domain.DateOf(time.Now()), asOf)
+			return []domain.Product{}, nil
+		},
+	}
+	h := handler.NewProductDefault(mockSvc)
+
+	req := httptest.NewRequest(http.MethodGet, "/products/expired", nil)
+	w := httptest.NewRecorder()
+
+	h.GetExpiredProducts().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
 func TestUpdateProduct_Success(t *testing.T) {
 	mockUpdatedProduct := domain.Product{
 		Id:    1,
@@ -326,6 +652,54 @@ func TestUpdateProduct_BadRequest(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestUpdateProduct_MalformedJSON(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+
+	req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBufferString("{"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id_product", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	h.UpdateProduct().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUpdateProduct_ValidationErrors(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+
+	req := httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewBufferString(`{"name":"Partial"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id_product", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	h.UpdateProduct().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestUpdateProductAttributes_ValidationErrors(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+
+	req := httptest.NewRequest(http.MethodPatch, "/products/1", bytes.NewBufferString(`{"quantity":-5}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id_product", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	h.UpdateProductAttributes().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
 func TestUpdateProductAttributes_Success(t *testing.T) {
 	mockUpdatedProduct := domain.Product{
 		Id:    2,
@@ -334,25 +708,19 @@ func TestUpdateProductAttributes_Success(t *testing.T) {
 	}
 
 	mockSvc := &mockProductService{
-		UpdateByIdFunc: func(id int, p domain.Product) (domain.Product, error) {
+		UpdateAttributesByIdFunc: func(id int, pr domain.ProductPatcher) (domain.Product, error) {
+			p := pr.(domain.ProductPatch)
 			assert.Equal(t, 2, id)
-			assert.Equal(t, "Produto Modificado", p.Name)
+			assert.Equal(t, "Produto Modificado", *p.Name)
+			assert.Equal(t, 55.55, *p.Price)
+			assert.Nil(t, p.Quantity)
 			return mockUpdatedProduct, nil
 		},
 	}
 
 	h := handler.NewProductDefault(mockSvc)
 
-	body := dto.CreateRequestProducts{
-		Name:        "Produto Modificado",
-		Quantity:    3,
-		CodeValue:   "Z987",
-		IsPublished: false,
-		Expiration:  "2024-12-31",
-		Price:       55.55,
-	}
-
-	bodyBytes, _ := json.Marshal(body)
+	bodyBytes := []byte(`{"name":"Produto Modificado","price":55.55}`)
 	req := httptest.NewRequest(http.MethodPatch, "/products/2", bytes.NewReader(bodyBytes))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
@@ -369,6 +737,170 @@ func TestUpdateProductAttributes_Success(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &resp)
 	assert.NoError(t, err)
 	assert.Equal(t, "success", resp["message"])
+	assert.Equal(t, "Produto Modificado", resp["data"].(map[string]interface{})["name"])
+}
+
+func TestUpdateProductAttributes_ZeroValues(t *testing.T) {
+	mockSvc := &mockProductService{
+		UpdateAttributesByIdFunc: func(id int, pr domain.ProductPatcher) (domain.Product, error) {
+			p := pr.(domain.ProductPatch)
+			assert.Equal(t, 0, *p.Quantity)
+			assert.False(t, *p.IsPublished)
+			assert.Nil(t, p.Name)
+			return domain.Product{Id: id}, nil
+		},
+	}
+
+	h := handler.NewProductDefault(mockSvc)
+
+	req := httptest.NewRequest(http.MethodPatch, "/products/2", bytes.NewBufferString(`{"quantity":0,"is_published":false}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id_product", "2")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	h.UpdateProductAttributes().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func newPatchRequest(contentType, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPatch, "/products/1", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id_product", "1")
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+// applyingPatchService applies the decoded patch to current, the way the
+// repository would.
+func applyingPatchService(current domain.Product) *mockProductService {
+	return &mockProductService{
+		UpdateAttributesByIdFunc: func(id int, pr domain.ProductPatcher) (domain.Product, error) {
+			return pr.Apply(current)
+		},
+	}
+}
+
+func TestUpdateProductAttributes_MergePatchNullResets(t *testing.T) {
+	current := domain.Product{Id: 1, Name: "Milk", Quantity: 4, Expiration: domain.NewDate(2025, time.January, 1), Price: 2}
+	h := handler.NewProductDefault(applyingPatchService(current))
+	w := httptest.NewRecorder()
+
+	h.UpdateProductAttributes().ServeHTTP(w, newPatchRequest(dto.MergePatchContentType, `{"expiration":null,"quantity":7}`))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message":"success","data":{"id":1,"name":"Milk","quantity":7,"code_value":"","is_published":false,"expiration":"","price":2}}`, w.Body.String())
+}
+
+func TestUpdateProductAttributes_MergePatchInvalidTypes(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+	w := httptest.NewRecorder()
+
+	h.UpdateProductAttributes().ServeHTTP(w, newPatchRequest(dto.MergePatchContentType, `{"quantity":"ten","is_published":"yes","expiration":7,"price":"free"}`))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var resp struct {
+		Errors []dto.FieldError `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.ElementsMatch(t, []dto.FieldError{
+		{Field: "quantity", Code: dto.CodeInvalidType, Message: "must be an integer"},
+		{Field: "is_published", Code: dto.CodeInvalidType, Message: "must be a boolean"},
+		{Field: "expiration", Code: dto.CodeInvalidType, Message: "must be a date (DD/MM/YYYY or YYYY-MM-DD)"},
+		{Field: "price", Code: dto.CodeInvalidType, Message: "must be a number"},
+	}, resp.Errors)
+}
+
+func TestUpdateProductAttributes_JSONPatch(t *testing.T) {
+	current := domain.Product{Id: 1, Name: "Milk", Quantity: 4, IsPublished: true, Price: 2}
+	h := handler.NewProductDefault(applyingPatchService(current))
+	w := httptest.NewRecorder()
+
+	h.UpdateProductAttributes().ServeHTTP(w, newPatchRequest(dto.JSONPatchContentType, `[
+		{"op":"test","path":"/quantity","value":4},
+		{"op":"replace","path":"/price","value":2.5},
+		{"op":"add","path":"/name","value":"Whole milk"},
+		{"op":"remove","path":"/is_published"}
+	]`))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message":"success","data":{"id":1,"name":"Whole milk","quantity":4,"code_value":"","is_published":false,"expiration":"","price":2.5}}`, w.Body.String())
+}
+
+func TestUpdateProductAttributes_JSONPatchTestFails(t *testing.T) {
+	current := domain.Product{Id: 1, Name: "Milk", Quantity: 4, Price: 2}
+	h := handler.NewProductDefault(applyingPatchService(current))
+	w := httptest.NewRecorder()
+
+	h.UpdateProductAttributes().ServeHTTP(w, newPatchRequest(dto.JSONPatchContentType, `[
+		{"op":"test","path":"/quantity","value":5},
+		{"op":"replace","path":"/quantity","value":0}
+	]`))
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestUpdateProductAttributes_JSONPatchInvalidOperations(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+	w := httptest.NewRecorder()
+
+	h.UpdateProductAttributes().ServeHTTP(w, newPatchRequest(dto.JSONPatchContentType, `[
+		{"op":"move","path":"/name","from":"/code_value"},
+		{"op":"replace","path":"/id","value":9},
+		{"op":"replace","path":"/colour","value":"red"},
+		{"op":"replace","path":"/quantity","value":"ten"}
+	]`))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var resp struct {
+		Errors []dto.FieldError `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Errors, 4)
+	assert.Contains(t, resp.Errors, dto.FieldError{Field: "/3/value", Code: dto.CodeInvalidType, Message: "must be an integer"})
+}
+
+func TestUpdateProductAttributes_JSONPatchNullValueIsMissing(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+	w := httptest.NewRecorder()
+
+	h.UpdateProductAttributes().ServeHTTP(w, newPatchRequest(dto.JSONPatchContentType, `[
+		{"op":"replace","path":"/quantity","value":null},
+		{"op":"test","path":"/name"}
+	]`))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var resp struct {
+		Errors []dto.FieldError `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []dto.FieldError{
+		{Field: "/0/value", Code: dto.CodeRequired, Message: "must be present for replace"},
+		{Field: "/1/value", Code: dto.CodeRequired, Message: "must be present for test"},
+	}, resp.Errors)
+}
+
+func TestUpdateProductAttributes_JSONPatchInvalidResult(t *testing.T) {
+	current := domain.Product{Id: 1, Name: "Milk", Quantity: 4, Price: 2}
+	h := handler.NewProductDefault(applyingPatchService(current))
+	w := httptest.NewRecorder()
+
+	h.UpdateProductAttributes().ServeHTTP(w, newPatchRequest(dto.JSONPatchContentType, `[{"op":"remove","path":"/price"}]`))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestUpdateProductAttributes_UnsupportedMediaType(t *testing.T) {
+	h := handler.NewProductDefault(&mockProductService{})
+	w := httptest.NewRecorder()
+
+	h.UpdateProductAttributes().ServeHTTP(w, newPatchRequest("text/plain", `name=Milk`))
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
 }
 
 func TestUpdateProductAttributes_BadRequest(t *testing.T) {
@@ -414,6 +946,28 @@ func TestDeleteProduct_Success(t *testing.T) {
 	assert.Equal(t, http.StatusNoContent, w.Code)
 }
 
+func TestDeleteProduct_NotFound(t *testing.T) {
+	mockSvc := &mockProductService{
+		DeleteByIdFunc: func(id int) error {
+			return domain.ProductNotFound(id)
+		},
+	}
+
+	h := handler.NewProductDefault(mockSvc)
+
+	req := httptest.NewRequest(http.MethodDelete, "/products/9", nil)
+	w := httptest.NewRecorder()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id_product", "9")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	h.DeleteProduct().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"type":"/problems/not-found","title":"Resource not found","status":404,"detail":"Product 9 not found.","instance":"/products/9","code":"not-found"}`, w.Body.String())
+}
+
 func TestDeleteProduct_BadRequest(t *testing.T) {
 	mockSvc := &mockProductService{}
 
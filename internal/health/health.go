@@ -0,0 +1,160 @@
+// Package health runs named checks and reports their outcome as JSON, for
+// liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Check reports why a dependency is unhealthy, or nil.
+type Check func(ctx context.Context) error
+
+// Checker is implemented by components that bring their own checks, such as
+// the loader and the repository backends.
+type Checker interface {
+	RegisterChecks(r *Registry)
+}
+
+// Status is the outcome of a check or of a whole report.
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+type ConfigRegistry struct {
+	// Timeout bounds each check; a check still running then is down.
+	Timeout time.Duration
+}
+
+func NewRegistry(cfg *ConfigRegistry) *Registry {
+	defaultConfig := &ConfigRegistry{
+		Timeout: 2 * time.Second,
+	}
+	if cfg != nil {
+		if cfg.Timeout > 0 {
+			defaultConfig.Timeout = cfg.Timeout
+		}
+	}
+
+	return &Registry{
+		timeout: defaultConfig.Timeout,
+		checks:  make(map[string]Check),
+	}
+}
+
+// Registry holds the checks reported together on one endpoint.
+type Registry struct {
+	timeout time.Duration
+
+	mu     sync.Mutex
+	checks map[string]Check
+}
+
+// Register adds check under name. Names must be unique.
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.checks[name]; ok {
+		panic("health: duplicate check " + name)
+	}
+	r.checks[name] = check
+}
+
+// Report is the outcome of every check; it is up only if all checks are.
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type Result struct {
+	Status     Status  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// Run runs every check concurrently.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = r.checks[name]
+	}
+	r.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = r.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// run waits for check up to the timeout. A check ignoring its context is
+// left to finish in the background.
+func (r *Registry) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() { errc <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errors.New("timed out")
+	}
+
+	res := Result{Status: StatusUp, DurationMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status, res.Error = StatusDown, err.Error()
+	}
+	return res
+}
+
+// Handler serves the report: 200 when up, 503 when down.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Run(req.Context())
+
+		status := http.StatusOK
+		if report.Status != StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	})
+}
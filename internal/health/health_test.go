@@ -0,0 +1,66 @@
+package health_test
+
+import (
+	"app/internal/health"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Run(t *testing.T) {
+	r := health.NewRegistry(&health.ConfigRegistry{Timeout: 20 * time.Millisecond})
+	r.Register("db", func(context.Context) error { return nil })
+	report := r.Run(context.Background())
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Equal(t, health.StatusUp, report.Checks["db"].Status)
+
+	r.Register("disk", func(context.Context) error { return errors.New("read-only file system") })
+	r.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	report = r.Run(context.Background())
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, health.Result{Status: health.StatusDown, Error: "read-only file system", DurationMs: report.Checks["disk"].DurationMs}, report.Checks["disk"])
+	assert.Equal(t, "timed out", report.Checks["slow"].Error)
+	assert.Equal(t, health.StatusUp, report.Checks["db"].Status)
+}
+
+func TestRegistry_RegisterDuplicatePanics(t *testing.T) {
+	r := health.NewRegistry(nil)
+	r.Register("db", func(context.Context) error { return nil })
+	assert.Panics(t, func() { r.Register("db", func(context.Context) error { return nil }) })
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	var failure error
+	r := health.NewRegistry(nil)
+	r.Register("store", func(context.Context) error { return failure })
+
+	serve := func() (*httptest.ResponseRecorder, health.Report) {
+		w := httptest.NewRecorder()
+		r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report health.Report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w, report
+	}
+
+	w, report := serve()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, health.StatusUp, report.Status)
+
+	failure = errors.New("journal is closed")
+	w, report = serve()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, "journal is closed", report.Checks["store"].Error)
+}
@@ -0,0 +1,31 @@
+package loader
+
+import (
+	"app/internal/health"
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// registerFileChecks registers catalog_file, which fails once path can no
+// longer be opened for reading.
+func registerFileChecks(r *health.Registry, path string) {
+	r.Register("catalog_file", func(context.Context) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		return file.Close()
+	})
+}
+
+// writable reports whether fsutil.WriteFileAtomic could replace path, by
+// creating and removing a temporary file next to it.
+func writable(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
@@ -0,0 +1,374 @@
+package loader
+
+import (
+	"app/internal/domain"
+	"app/internal/dto"
+	"app/internal/fsutil"
+	"app/internal/health"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProductCSVFields are the product fields a CSV column can hold, in the
+// column order the writer uses.
+var ProductCSVFields = []string{"id", "name", "quantity", "code_value", "is_published", "expiration", "price"}
+
+// CSVHeader maps column titles, as spreadsheets name them, to product
+// fields, e.g. {"SKU": "code_value"}. Titles match case-insensitively.
+// Columns it leaves out match the field of the same name, spaces read as
+// underscores, so "Code Value" needs no mapping; columns matching nothing
+// are ignored.
+type CSVHeader map[string]string
+
+// ParseCSVHeader parses a header mapping written as comma separated
+// title:field entries. The field is the last part, so a title may contain
+// colons.
+func ParseCSVHeader(s string) (CSVHeader, error) {
+	h := make(CSVHeader)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("column %q: expected title:field", entry)
+		}
+		h[entry[:i]] = strings.TrimSpace(entry[i+1:])
+	}
+	return h, nil
+}
+
+// ProductCSVRow is one data row of a CSV catalog. Id is 0 when the row has
+// none. Errors lists every cell that did not parse or broke product rules;
+// Product is only meaningful without errors.
+type ProductCSVRow struct {
+	Line    int
+	Id      int
+	Product domain.Product
+	Errors  dto.ValidationErrors
+}
+
+// NewProductCSVReader reads the header row of r and resolves its columns.
+// The name and price columns are required.
+func NewProductCSVReader(r io.Reader, header CSVHeader) (*ProductCSVReader, error) {
+	fields := make(map[string]string, len(ProductCSVFields))
+	for _, f := range ProductCSVFields {
+		fields[f] = f
+	}
+	titles := make(map[string]string, len(header))
+	for title, field := range header {
+		if _, ok := fields[field]; !ok {
+			return nil, fmt.Errorf("column %q: unknown field %q", title, field)
+		}
+		titles[normalizeTitle(title)] = field
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	record, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv: missing header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ProductCSVReader{r: cr, columns: make(map[string]int)}
+	for i, title := range record {
+		if i == 0 {
+			title = strings.TrimPrefix(title, "\ufeff")
+		}
+		key := normalizeTitle(title)
+		field, ok := titles[key]
+		if !ok {
+			field, ok = fields[key]
+		}
+		if !ok {
+			continue
+		}
+		if _, dup := c.columns[field]; dup {
+			return nil, fmt.Errorf("csv: more than one column for %s", field)
+		}
+		c.columns[field] = i
+	}
+	for _, field := range []string{"name", "price"} {
+		if _, ok := c.columns[field]; !ok {
+			return nil, fmt.Errorf("csv: missing %s column", field)
+		}
+	}
+
+	return c, nil
+}
+
+// ProductCSVReader reads products from CSV, one row at a time.
+type ProductCSVReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// HasColumn reports whether the header has a column for field.
+func (c *ProductCSVReader) HasColumn(field string) bool {
+	_, ok := c.columns[field]
+	return ok
+}
+
+// Read returns the next row, skipping blank ones, or io.EOF. Cell problems
+// are reported in the row; an error means the CSV itself is malformed and
+// reading cannot go on.
+func (c *ProductCSVReader) Read() (row ProductCSVRow, err error) {
+	var record []string
+	for {
+		if record, err = c.r.Read(); err != nil {
+			return
+		}
+		if !blank(record) {
+			break
+		}
+	}
+	row.Line, _ = c.r.FieldPos(0)
+
+	cell := func(field string) string {
+		i, ok := c.columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	fail := func(field, code, message string) {
+		row.Errors = append(row.Errors, dto.FieldError{Field: field, Code: code, Message: message})
+	}
+
+	if s := cell("id"); s != "" {
+		if row.Id, err = strconv.Atoi(s); err != nil || row.Id < 1 {
+			fail("id", dto.CodeInvalidNumber, fmt.Sprintf("%q is not a positive integer", s))
+		}
+	}
+
+	req := dto.CreateRequestProducts{
+		Name:       unescapeCell(cell("name")),
+		CodeValue:  unescapeCell(cell("code_value")),
+		Expiration: cell("expiration"),
+	}
+	if s := cell("quantity"); s != "" {
+		if req.Quantity, err = strconv.Atoi(s); err != nil {
+			fail("quantity", dto.CodeInvalidNumber, fmt.Sprintf("%q is not an integer", s))
+		}
+	}
+	if s := cell("price"); s != "" {
+		if req.Price, err = strconv.ParseFloat(s, 64); err != nil {
+			fail("price", dto.CodeInvalidNumber, fmt.Sprintf("%q is not a number", s))
+		}
+	}
+	if s := cell("is_published"); s != "" {
+		if req.IsPublished, err = parseCSVBool(s); err != nil {
+			fail("is_published", dto.CodeInvalidBool, fmt.Sprintf("%q is not true or false", s))
+		}
+	}
+	err = nil
+
+	// Cells that did not parse hold zero values; skip their rule checks so
+	// each field is reported once.
+	for _, e := range req.Validate() {
+		if !row.Errors.Has(e.Field) {
+			row.Errors = append(row.Errors, e)
+		}
+	}
+	if len(row.Errors) > 0 {
+		return
+	}
+
+	if row.Product, err = req.ToDomain(); err != nil {
+		return
+	}
+	row.Product.Id = row.Id
+	return
+}
+
+// NewProductCSVFile reads and writes the catalog as CSV at path.
+func NewProductCSVFile(path string, header CSVHeader) *ProductCSVFile {
+	return &ProductCSVFile{
+		path:   path,
+		header: header,
+	}
+}
+
+// ProductCSVFile is a catalog kept as CSV, e.g. exported from a spreadsheet.
+// Every row needs an id.
+type ProductCSVFile struct {
+	path   string
+	header CSVHeader
+}
+
+// Load reads the whole catalog. The first invalid row fails the load,
+// reported with its line.
+func (l *ProductCSVFile) Load() (p map[int]domain.Product, err error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	r, err := NewProductCSVReader(file, l.header)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", l.path, err)
+	}
+	if !r.HasColumn("id") {
+		return nil, fmt.Errorf("%s: csv: missing id column", l.path)
+	}
+
+	p = make(map[int]domain.Product)
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return p, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", l.path, err)
+		}
+
+		switch {
+		case len(row.Errors) > 0:
+			return nil, fmt.Errorf("%s: line %d: %w", l.path, row.Line, row.Errors)
+		case row.Id == 0:
+			return nil, fmt.Errorf("%s: line %d: id: must not be empty", l.path, row.Line)
+		}
+		if _, ok := p[row.Id]; ok {
+			return nil, fmt.Errorf("%s: line %d: duplicate id %d", l.path, row.Line, row.Id)
+		}
+		p[row.Id] = row.Product
+	}
+}
+
+// Save replaces the file with p ordered by id, with the canonical header,
+// atomically like ProductJSONFile.Save.
+func (l *ProductCSVFile) Save(p map[int]domain.Product) error {
+	products := make([]domain.Product, 0, len(p))
+	for _, pr := range p {
+		products = append(products, pr)
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].Id < products[j].Id
+	})
+
+	var buf bytes.Buffer
+	w := NewProductCSVWriter(&buf)
+	for _, pr := range products {
+		w.Write(pr)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(l.path, buf.Bytes())
+}
+
+// RegisterChecks registers catalog_file, which fails once the catalog can no
+// longer be read.
+func (l *ProductCSVFile) RegisterChecks(r *health.Registry) {
+	registerFileChecks(r, l.path)
+}
+
+// Writable reports whether Save could replace the file.
+func (l *ProductCSVFile) Writable() error {
+	return writable(l.path)
+}
+
+// NewProductCSVWriter writes products as CSV to w, starting with the header
+// row of ProductCSVFields.
+func NewProductCSVWriter(w io.Writer) *ProductCSVWriter {
+	return &ProductCSVWriter{w: csv.NewWriter(w)}
+}
+
+// ProductCSVWriter buffers its output; call Flush to write it out.
+type ProductCSVWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+// Write writes one product; errors surface on Flush. Text cells that a
+// spreadsheet would run as a formula are escaped, see escapeCell.
+func (c *ProductCSVWriter) Write(p domain.Product) {
+	c.header()
+	c.w.Write([]string{
+		strconv.Itoa(p.Id),
+		escapeCell(p.Name),
+		strconv.Itoa(p.Quantity),
+		escapeCell(p.CodeValue),
+		strconv.FormatBool(p.IsPublished),
+		p.Expiration.String(),
+		strconv.FormatFloat(p.Price, 'f', -1, 64),
+	})
+}
+
+// Flush writes out the buffered rows, and the header if no row was written.
+func (c *ProductCSVWriter) Flush() error {
+	c.header()
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *ProductCSVWriter) header() {
+	if !c.wroteHeader {
+		c.w.Write(ProductCSVFields)
+		c.wroteHeader = true
+	}
+}
+
+// formulaPrefixes are the first characters that make spreadsheets read a
+// cell as a formula.
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeCell prefixes text starting like a formula with a quote, which
+// spreadsheets show as text and drop from the displayed value, so an exported
+// product name can not run as a formula on the machine opening the file.
+// Text already starting with a quote gets one more, so unescapeCell can tell
+// the two apart.
+func escapeCell(s string) string {
+	if s != "" && strings.ContainsRune(formulaPrefixes+"'", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// unescapeCell undoes escapeCell, so exported catalogs import unchanged.
+func unescapeCell(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(formulaPrefixes+"'", rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+func normalizeTitle(title string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(title)), " ", "_")
+}
+
+func blank(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCSVBool accepts what spreadsheets write for a checkbox besides
+// strconv.ParseBool's forms.
+func parseCSVBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes", "y":
+		return true, nil
+	case "no", "n":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
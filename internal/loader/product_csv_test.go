@@ -0,0 +1,172 @@
+package loader_test
+
+import (
+	"app/internal/domain"
+	"app/internal/dto"
+	"app/internal/loader"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, r *loader.ProductCSVReader) []loader.ProductCSVRow {
+	t.Helper()
+
+	var rows []loader.ProductCSVRow
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		require.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestProductCSVReader_MapsHeader(t *testing.T) {
+	csv := "\ufeffSKU,Product Name, Qty ,Published,Expiration,Unit Price,Notes\n" +
+		"M1,Milk,3,yes,31/01/2025,1.25,fridge\n" +
+		",,,,,,\n" +
+		"\n" +
+		"B1,\"Bread, rye\",,no,,2,\n"
+
+	header, err := loader.ParseCSVHeader("SKU:code_value, Product Name:name, Qty:quantity, Published:is_published, unit price:price")
+	require.NoError(t, err)
+	r, err := loader.NewProductCSVReader(strings.NewReader(csv), header)
+	require.NoError(t, err)
+	assert.False(t, r.HasColumn("id"))
+
+	rows := readAll(t, r)
+	require.Len(t, rows, 2)
+	assert.Equal(t, loader.ProductCSVRow{Line: 2, Product: domain.Product{
+		Name: "Milk", Quantity: 3, CodeValue: "M1", IsPublished: true, Expiration: domain.NewDate(2025, time.January, 31), Price: 1.25,
+	}}, rows[0])
+	assert.Equal(t, 5, rows[1].Line)
+	assert.Equal(t, "Bread, rye", rows[1].Product.Name)
+	assert.Empty(t, rows[1].Errors)
+}
+
+func TestProductCSVReader_ReportsEveryBadCell(t *testing.T) {
+	csv := "id,name,quantity,is_published,expiration,price\n" +
+		"x,,-1,maybe,30/02/2025,abc\n" +
+		"7,Tea,2,true,,0\n"
+
+	r, err := loader.NewProductCSVReader(strings.NewReader(csv), nil)
+	require.NoError(t, err)
+	rows := readAll(t, r)
+	require.Len(t, rows, 2)
+
+	codes := map[string]string{}
+	for _, e := range rows[0].Errors {
+		codes[e.Field] = e.Code
+	}
+	assert.Equal(t, map[string]string{
+		"id":           dto.CodeInvalidNumber,
+		"name":         dto.CodeRequired,
+		"quantity":     dto.CodeNegative,
+		"is_published": dto.CodeInvalidBool,
+		"expiration":   dto.CodeInvalidDate,
+		"price":        dto.CodeInvalidNumber,
+	}, codes)
+	assert.Len(t, rows[0].Errors, 6, "one error per field")
+
+	assert.Equal(t, 7, rows[1].Id)
+	assert.Equal(t, dto.ValidationErrors{{Field: "price", Code: dto.CodeNotPositive, Message: "must be greater than zero"}}, rows[1].Errors)
+}
+
+func TestNewProductCSVReader_RejectsBadHeader(t *testing.T) {
+	tests := map[string]struct {
+		csv    string
+		header loader.CSVHeader
+	}{
+		"empty":          {"", nil},
+		"missing price":  {"name,quantity\n", nil},
+		"duplicate":      {"name,price,Price\n", nil},
+		"mapped twice":   {"name,price,Cost\n", loader.CSVHeader{"Cost": "price"}},
+		"unknown target": {"name,price\n", loader.CSVHeader{"Notes": "notes"}},
+	}
+	for name, tt := range tests {
+		_, err := loader.NewProductCSVReader(strings.NewReader(tt.csv), tt.header)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestProductCSVFile_SaveLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.csv")
+	ld := loader.NewProductCSVFile(path, nil)
+	products := map[int]domain.Product{
+		1: {Id: 1, Name: "Milk", Quantity: 3, CodeValue: "M1", IsPublished: true, Expiration: domain.NewDate(2025, time.January, 31), Price: 1.25},
+		4: {Id: 4, Name: `Bread "rye", sliced`, Quantity: 0, Price: 2},
+	}
+
+	require.NoError(t, ld.Save(products))
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "id,name,quantity,code_value,is_published,expiration,price\n"+
+		"1,Milk,3,M1,true,31/01/2025,1.25\n"+
+		"4,\"Bread \"\"rye\"\", sliced\",0,,false,,2\n", string(b))
+
+	loaded, err := ld.Load()
+	require.NoError(t, err)
+	assert.Equal(t, products, loaded)
+}
+
+func TestProductCSVFile_EscapesFormulas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.csv")
+	ld := loader.NewProductCSVFile(path, nil)
+	products := map[int]domain.Product{
+		1: {Id: 1, Name: `=HYPERLINK("http://evil.example","Milk")`, CodeValue: "+M1", Price: 1},
+		2: {Id: 2, Name: "@SUM(A1:A9)", CodeValue: "-M2", Price: 1},
+		3: {Id: 3, Name: "'quoted", CodeValue: "\tM3", Price: 1},
+		4: {Id: 4, Name: "'=x", CodeValue: "''M4", Price: 1},
+	}
+
+	require.NoError(t, ld.Save(products))
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "id,name,quantity,code_value,is_published,expiration,price\n"+
+		"1,\"'=HYPERLINK(\"\"http://evil.example\"\",\"\"Milk\"\")\",0,'+M1,false,,1\n"+
+		"2,'@SUM(A1:A9),0,'-M2,false,,1\n"+
+		"3,''quoted,0,'\tM3,false,,1\n"+
+		"4,''=x,0,'''M4,false,,1\n", string(b))
+
+	loaded, err := ld.Load()
+	require.NoError(t, err)
+	assert.Equal(t, products, loaded)
+}
+
+func TestProductCSVFile_LoadRejectsInvalidCatalog(t *testing.T) {
+	tests := map[string]struct {
+		csv string
+		msg string
+	}{
+		"no id column":   {"name,price\nMilk,1\n", "missing id column"},
+		"row without id": {"id,name,price\n1,Milk,1\n,Tea,2\n", "line 3: id: must not be empty"},
+		"duplicate id":   {"id,name,price\n1,Milk,1\n1,Tea,2\n", "line 3: duplicate id 1"},
+		"invalid row":    {"id,name,price\n1,Milk,0\n", "line 2: price: must be greater than zero"},
+		"malformed":      {"id,name,price\n1,\"Milk,1\n", "extraneous or missing \" in quoted-field"},
+	}
+	for name, tt := range tests {
+		path := filepath.Join(t.TempDir(), "products.csv")
+		require.NoError(t, os.WriteFile(path, []byte(tt.csv), 0644))
+
+		_, err := loader.NewProductCSVFile(path, nil).Load()
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), tt.msg, name)
+		}
+	}
+}
+
+func TestProductCSVWriter_HeaderOnlyWhenEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, loader.NewProductCSVWriter(&buf).Flush())
+	assert.Equal(t, "id,name,quantity,code_value,is_published,expiration,price\n", buf.String())
+}
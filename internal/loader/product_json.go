@@ -2,8 +2,13 @@ package loader
 
 import (
 	"app/internal/domain"
+	"app/internal/fsutil"
+	"app/internal/health"
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
+	"sort"
 )
 
 func NewProductJSONFile(path string) *ProductJSONFile {
@@ -16,6 +21,18 @@ type ProductJSONFile struct {
 	path string
 }
 
+// productJSON mirrors domain.Product with the expiration kept as text, so a
+// bad date can be reported together with the record it belongs to.
+type productJSON struct {
+	Id          int     `json:"id"`
+	Name        string  `json:"name"`
+	Quantity    int     `json:"quantity"`
+	CodeValue   string  `json:"code_value"`
+	IsPublished bool    `json:"is_published"`
+	Expiration  string  `json:"expiration"`
+	Price       float64 `json:"price"`
+}
+
 func (l *ProductJSONFile) Load() (p map[int]domain.Product, err error) {
 	file, err := os.Open(l.path)
 	if err != nil {
@@ -23,24 +40,73 @@ func (l *ProductJSONFile) Load() (p map[int]domain.Product, err error) {
 	}
 	defer file.Close()
 
-	var productJSON []domain.Product
-	err = json.NewDecoder(file).Decode(&productJSON)
+	var products []productJSON
+	err = json.NewDecoder(file).Decode(&products)
 	if err != nil {
 		return
 	}
 
 	p = make(map[int]domain.Product)
-	for _, pr := range productJSON {
+	for i, pr := range products {
+		var expiration domain.Date
+		if pr.Expiration != "" {
+			expiration, err = domain.ParseDate(pr.Expiration)
+			if err != nil {
+				return nil, fmt.Errorf("%s: record %d (id %d): expiration: %w", l.path, i, pr.Id, err)
+			}
+		}
+
 		p[pr.Id] = domain.Product{
 			Id:          pr.Id,
 			Name:        pr.Name,
 			Quantity:    pr.Quantity,
 			CodeValue:   pr.CodeValue,
 			IsPublished: pr.IsPublished,
-			Expiration:  pr.Expiration,
+			Expiration:  expiration,
 			Price:       pr.Price,
 		}
 	}
 
 	return
 }
+
+// RegisterChecks registers catalog_file, which fails once the catalog can no
+// longer be read.
+func (l *ProductJSONFile) RegisterChecks(r *health.Registry) {
+	registerFileChecks(r, l.path)
+}
+
+// Writable reports whether Save could replace the file.
+func (l *ProductJSONFile) Writable() error {
+	return writable(l.path)
+}
+
+// Save replaces the file with p, one product per line ordered by id. The data
+// is written to a temporary file in the same directory, synced and renamed
+// over the original, so a crash leaves either the old or the new catalog on
+// disk and never a partially written one.
+func (l *ProductJSONFile) Save(p map[int]domain.Product) (err error) {
+	products := make([]domain.Product, 0, len(p))
+	for _, pr := range p {
+		products = append(products, pr)
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].Id < products[j].Id
+	})
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, pr := range products {
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		b, err := json.Marshal(pr)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte(']')
+
+	return fsutil.WriteFileAtomic(l.path, buf.Bytes())
+}
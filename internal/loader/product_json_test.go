@@ -0,0 +1,116 @@
+package loader_test
+
+import (
+	"app/internal/domain"
+	"app/internal/health"
+	"app/internal/loader"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductJSONFile_SaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	ld := loader.NewProductJSONFile(path)
+	products := map[int]domain.Product{
+		2: {Id: 2, Name: "Pineapple", Quantity: 345, CodeValue: "M4637", IsPublished: true, Expiration: domain.NewDate(2021, time.August, 9), Price: 352.79},
+		1: {Id: 1, Name: "Margarine", Quantity: 439, CodeValue: "S82254D", Expiration: domain.NewDate(2021, time.December, 15), Price: 71.42},
+	}
+
+	require.NoError(t, ld.Save(products))
+
+	loaded, err := ld.Load()
+	require.NoError(t, err)
+	assert.Equal(t, products, loaded)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `[{"id":1,"name":"Margarine","quantity":439,"code_value":"S82254D","is_published":false,"expiration":"15/12/2021","price":71.42},
+{"id":2,"name":"Pineapple","quantity":345,"code_value":"M4637","is_published":true,"expiration":"09/08/2021","price":352.79}]`, string(raw))
+}
+
+func TestProductJSONFile_SaveLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	ld := loader.NewProductJSONFile(filepath.Join(dir, "products.json"))
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, ld.Save(map[int]domain.Product{i: {Id: i}}))
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "products.json", entries[0].Name())
+}
+
+func TestProductJSONFile_SavePreservesFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	require.NoError(t, os.WriteFile(path, []byte("[]"), 0644))
+	ld := loader.NewProductJSONFile(path)
+
+	require.NoError(t, ld.Save(map[int]domain.Product{1: {Id: 1}}))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+func TestProductJSONFile_CrashDuringSaveKeepsPreviousCatalog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "products.json")
+	ld := loader.NewProductJSONFile(path)
+	require.NoError(t, ld.Save(map[int]domain.Product{1: {Id: 1, Name: "Original"}}))
+
+	// A crash between creating the temp file and renaming it leaves a partial
+	// temp file behind; the catalog itself must be untouched.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "products.json.123.tmp"), []byte(`[{"id":1,"na`), 0600))
+
+	loaded, err := ld.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "Original", loaded[1].Name)
+}
+
+func TestProductJSONFile_SaveFailsWithoutTouchingTarget(t *testing.T) {
+	ld := loader.NewProductJSONFile(filepath.Join(t.TempDir(), "missing", "products.json"))
+
+	err := ld.Save(map[int]domain.Product{1: {Id: 1}})
+
+	assert.Error(t, err)
+}
+
+func TestProductJSONFile_LoadReportsRecordWithBadDate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id":1,"expiration":"15/12/2021"},
+{"id":7,"expiration":"31/02/2021"}]`), 0644))
+
+	_, err := loader.NewProductJSONFile(path).Load()
+
+	assert.ErrorContains(t, err, "record 1 (id 7): expiration")
+}
+
+func TestProductJSONFile_Checks(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "products.json")
+	ld := loader.NewProductJSONFile(path)
+	reg := health.NewRegistry(nil)
+	ld.RegisterChecks(reg)
+
+	report := reg.Run(ctx)
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.NotEmpty(t, report.Checks["catalog_file"].Error)
+
+	require.NoError(t, ld.Save(map[int]domain.Product{1: {Id: 1}}))
+	assert.Equal(t, health.StatusUp, reg.Run(ctx).Status)
+	assert.NoError(t, ld.Writable())
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.Error(t, loader.NewProductJSONFile(filepath.Join(path, "nested", "products.json")).Writable())
+}
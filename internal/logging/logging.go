@@ -0,0 +1,82 @@
+// Package logging carries a request scoped slog.Logger through context, so
+// log lines written anywhere while serving a request share its request id
+// and principal.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// New returns a logger writing JSON lines to w.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// ParseLevel parses debug, info, warn or error; empty is info.
+func ParseLevel(s string) (level slog.Level, err error) {
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err = level.UnmarshalText([]byte(strings.ToUpper(s)))
+	return
+}
+
+type (
+	loggerKey  struct{}
+	requestKey struct{}
+)
+
+// request collects the attributes added while serving one request, for the
+// access log line written once it is done.
+type request struct {
+	mu    sync.Mutex
+	attrs []any
+}
+
+// FromContext returns the logger of ctx, or slog.Default if there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// StartRequest returns a copy of ctx carrying logger and collecting the
+// attributes later passed to With, see RequestAttrs.
+func StartRequest(ctx context.Context, logger *slog.Logger) context.Context {
+	ctx = context.WithValue(ctx, requestKey{}, &request{})
+	return NewContext(ctx, logger)
+}
+
+// With returns a copy of ctx whose logger adds args to every line. The args
+// are also recorded for the access log of the request, if any.
+func With(ctx context.Context, args ...any) context.Context {
+	if rq, ok := ctx.Value(requestKey{}).(*request); ok {
+		rq.mu.Lock()
+		rq.attrs = append(rq.attrs, args...)
+		rq.mu.Unlock()
+	}
+	return NewContext(ctx, FromContext(ctx).With(args...))
+}
+
+// RequestAttrs returns the args passed to With during the request started on
+// ctx.
+func RequestAttrs(ctx context.Context) []any {
+	rq, ok := ctx.Value(requestKey{}).(*request)
+	if !ok {
+		return nil
+	}
+
+	rq.mu.Lock()
+	defer rq.mu.Unlock()
+	return append([]any(nil), rq.attrs...)
+}
@@ -0,0 +1,52 @@
+package metrics_test
+
+import (
+	"app/internal/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_WritesTextFormat(t *testing.T) {
+	reg := metrics.NewRegistry()
+	requests := reg.NewCounterVec("requests_total", "Requests.\nBy route.", "route", "status")
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	reg.NewGaugeFunc("products", "Products.", func() float64 { return 3 })
+
+	requests.Inc("/products", "200")
+	requests.Add(2, "/products", "200")
+	requests.Inc(`/a"b\c`, "404")
+	latency.Observe(0.05, "/products")
+	latency.Observe(0.5, "/products")
+	latency.Observe(2, "/products")
+
+	w := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, metrics.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/products",le="0.1"} 1
+latency_seconds_bucket{route="/products",le="1"} 2
+latency_seconds_bucket{route="/products",le="+Inf"} 3
+latency_seconds_sum{route="/products"} 2.55
+latency_seconds_count{route="/products"} 3
+# HELP products Products.
+# TYPE products gauge
+products 3
+# HELP requests_total Requests.\nBy route.
+# TYPE requests_total counter
+requests_total{route="/a\"b\\c",status="404"} 1
+requests_total{route="/products",status="200"} 3
+`, w.Body.String())
+}
+
+func TestRegistry_Misuse(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := reg.NewCounterVec("requests_total", "Requests.", "route")
+
+	assert.Panics(t, func() { reg.NewCounterVec("requests_total", "Again.") })
+	assert.Panics(t, func() { c.Inc("/products", "200") })
+}
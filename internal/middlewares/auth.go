@@ -1,19 +1,305 @@
 package middlewares
 
 import (
+	"app/internal/logging"
+	"app/internal/problem"
+	"app/internal/token"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"strings"
+)
+
+// Role grants access to a set of routes. Roles are ordered: every role is
+// allowed what the roles below it are.
+type Role string
 
-	"github.com/bootcamp-go/web/response"
+const (
+	RoleReader Role = "reader"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
+var roleRank = map[Role]int{
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// Allows reports whether r includes the permissions of required.
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] > 0 && roleRank[r] >= roleRank[required]
+}
+
+// APIKey is a credential accepted by the Authenticator.
+type APIKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	Role Role   `json:"role"`
+}
+
+// ClientCert maps the common name of a verified TLS client certificate to a
+// role.
+type ClientCert struct {
+	CommonName string `json:"common_name" yaml:"common_name"`
+	Role       Role   `json:"role" yaml:"role"`
+}
+
+// Principal is the identity a request was authenticated as.
+type Principal struct {
+	Name string
+	Role Role
+}
+
+type (
+	principalKey struct{}
+	claimsKey    struct{}
+)
+
+// PrincipalFrom returns the principal stored in ctx by the Authenticator.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// ClaimsFrom returns the claims of the token a request was authenticated
+// with. It reports false for requests authenticated with an API key.
+func ClaimsFrom(ctx context.Context) (token.Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(token.Claims)
+	return c, ok
+}
+
+// TokenVerifier checks a signed token and returns its claims.
+type TokenVerifier interface {
+	Verify(token string) (token.Claims, error)
+}
+
+// LoadAPIKeys reads a JSON array of API keys from path, e.g.
+// [{"name":"backoffice","key":"...","role":"editor"}].
+func LoadAPIKeys(path string) (keys []APIKey, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("api keys %s: %w", path, err)
+	}
+	return
+}
+
+// ParseAPIKeys parses API keys written as comma separated name:role:key
+// entries, the format of the API_KEYS environment variable. The key is the
+// last field, so it may itself contain colons. Errors name the entry by its
+// position, never by its text, which may be a key.
+func ParseAPIKeys(s string) (keys []APIKey, err error) {
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("api key entry %d: expected name:role:key", i+1)
+		}
+		keys = append(keys, APIKey{Name: parts[0], Role: Role(parts[1]), Key: parts[2]})
+	}
+	return
+}
+
+// ParseClientCerts parses client certificate mappings written as comma
+// separated cn:role entries, the format of the TLS_CLIENT_CERTS environment
+// variable. The role is the last field, so the common name may contain
+// colons.
+func ParseClientCerts(s string) (certs []ClientCert, err error) {
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("client cert %q: expected cn:role", entry)
+		}
+		certs = append(certs, ClientCert{CommonName: entry[:i], Role: Role(entry[i+1:])})
+	}
+	return
+}
+
+// NewAuthenticator accepts the given keys. Names and keys must be unique and
+// every role known. keys may be empty when tokens or client certs are
+// accepted instead.
+func NewAuthenticator(keys []APIKey) (*Authenticator, error) {
+	a := &Authenticator{keys: make([]storedKey, 0, len(keys))}
+	names := make(map[string]bool, len(keys))
+	hashes := make(map[[sha256.Size]byte]bool, len(keys))
+	for _, k := range keys {
+		switch {
+		case k.Name == "":
+			return nil, errors.New("api key without name")
+		case k.Key == "":
+			return nil, fmt.Errorf("api key %s: empty key", k.Name)
+		case roleRank[k.Role] == 0:
+			return nil, fmt.Errorf("api key %s: unknown role %q", k.Name, k.Role)
+		case names[k.Name]:
+			return nil, fmt.Errorf("api key %s: duplicate name", k.Name)
+		}
+
+		hash := sha256.Sum256([]byte(k.Key))
+		if hashes[hash] {
+			return nil, fmt.Errorf("api key %s: duplicate key", k.Name)
+		}
+		names[k.Name], hashes[hash] = true, true
+
+		a.keys = append(a.keys, storedKey{hash: hash, principal: Principal{Name: k.Name, Role: k.Role}})
+	}
+
+	return a, nil
+}
+
+// Authenticator checks the API key of each request. Keys are kept as SHA-256
+// digests and compared in constant time against all of them, so neither the
+// length of a key nor which key came closest leaks through timing.
+type Authenticator struct {
+	keys   []storedKey
+	tokens TokenVerifier
+	certs  map[string]Principal
+}
+
+// AcceptTokens makes a also accept bearer tokens checked by v. A token's sub
+// claim becomes the principal name, prefixed with "token:", and its role
+// claim the principal role.
+func (a *Authenticator) AcceptTokens(v TokenVerifier) *Authenticator {
+	a.tokens = v
+	return a
+}
+
+// AcceptClientCerts makes a also accept requests without credentials that
+// presented a verified TLS client certificate with one of the given common
+// names. The principal is named after the common name, prefixed with
+// "cert:". Verifying the certificate is left to the TLS handshake.
+func (a *Authenticator) AcceptClientCerts(certs []ClientCert) error {
+	m := make(map[string]Principal, len(certs))
+	for _, c := range certs {
+		switch {
+		case c.CommonName == "":
+			return errors.New("client cert without common name")
+		case roleRank[c.Role] == 0:
+			return fmt.Errorf("client cert %s: unknown role %q", c.CommonName, c.Role)
+		}
+		if _, ok := m[c.CommonName]; ok {
+			return fmt.Errorf("client cert %s: duplicate common name", c.CommonName)
+		}
+		m[c.CommonName] = Principal{Name: "cert:" + c.CommonName, Role: c.Role}
+	}
+
+	a.certs = m
+	return nil
+}
+
+type storedKey struct {
+	hash      [sha256.Size]byte
+	principal Principal
+}
+
+// Authenticate rejects requests without a valid key or token and stores the
+// matching Principal, and the token claims if any, in the request context.
+// The credential is read from "Authorization: Bearer <key>"; a bare key is
+// accepted too, for clients written against the former single-token scheme.
+// Requests without one may authenticate with a client certificate, see
+// AcceptClientCerts.
+func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if token != "token12345" {
-			response.Error(w, http.StatusUnauthorized, "Not authorized.")
+		credential := bearerToken(r.Header.Get("Authorization"))
+
+		ctx := r.Context()
+		p, ok := a.lookup(credential)
+		if !ok && credential == "" {
+			p, ok = a.clientCert(r)
+		}
+		if !ok && a.tokens != nil && strings.Count(credential, ".") == 2 {
+			var c token.Claims
+			if c, ok = a.verify(credential); ok {
+				p = Principal{Name: "token:" + c.Subject, Role: Role(c.Role)}
+				ctx = context.WithValue(ctx, claimsKey{}, c)
+			}
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="products"`)
+			problem.Write(w, r, problem.Unauthorized, "Not authorized.")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx = logging.With(ctx, "principal", p.Name)
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(ctx, p)))
 	})
 }
+
+func (a *Authenticator) verify(credential string) (c token.Claims, ok bool) {
+	c, err := a.tokens.Verify(credential)
+	if err != nil || c.Subject == "" || roleRank[Role(c.Role)] == 0 {
+		return c, false
+	}
+	return c, true
+}
+
+// clientCert maps the leaf of the first verified chain; unverified
+// certificates never get here as their chains are empty.
+func (a *Authenticator) clientCert(r *http.Request) (p Principal, ok bool) {
+	if a.certs == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return
+	}
+	p, ok = a.certs[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+	return
+}
+
+func (a *Authenticator) lookup(key string) (p Principal, ok bool) {
+	if key == "" {
+		return
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash[:]) == 1 {
+			p, ok = k.principal, true
+		}
+	}
+	return
+}
+
+func bearerToken(header string) string {
+	header = strings.TrimSpace(header)
+	if scheme, credential, found := strings.Cut(header, " "); found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(credential)
+	}
+	return header
+}
+
+// RequireRole lets through only requests whose principal allows role. It must
+// run after Authenticate.
+func RequireRole(role Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFrom(r.Context())
+			if !ok {
+				problem.Write(w, r, problem.Unauthorized, "Not authorized.")
+				return
+			}
+			if !p.Role.Allows(role) {
+				problem.Write(w, r, problem.Forbidden, fmt.Sprintf("Role %s is required.", role))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package middlewares_test
+
+import (
+	"app/internal/middlewares"
+	"app/internal/token"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAuthenticator(t *testing.T) *middlewares.Authenticator {
+	t.Helper()
+
+	a, err := middlewares.NewAuthenticator([]middlewares.APIKey{
+		{Name: "dashboard", Key: "read-key", Role: middlewares.RoleReader},
+		{Name: "backoffice", Key: "edit-key", Role: middlewares.RoleEditor},
+		{Name: "ops", Key: "admin-key", Role: middlewares.RoleAdmin},
+	})
+	require.NoError(t, err)
+	return a
+}
+
+func TestAuthenticator_RolesPerRoute(t *testing.T) {
+	a := newTestAuthenticator(t)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := middlewares.PrincipalFrom(r.Context())
+		w.Write([]byte(p.Name))
+	})
+	read := a.Authenticate(middlewares.RequireRole(middlewares.RoleReader)(ok))
+	write := a.Authenticate(middlewares.RequireRole(middlewares.RoleEditor)(ok))
+
+	tests := []struct {
+		name          string
+		authorization string
+		handler       http.Handler
+		status        int
+		body          string
+	}{
+		{"reader reads", "Bearer read-key", read, http.StatusOK, "dashboard"},
+		{"reader writes", "Bearer read-key", write, http.StatusForbidden, ""},
+		{"editor writes", "Bearer edit-key", write, http.StatusOK, "backoffice"},
+		{"admin writes", "bearer  admin-key", write, http.StatusOK, "ops"},
+		{"bare key", "edit-key", write, http.StatusOK, "backoffice"},
+		{"unknown key", "Bearer nope", read, http.StatusUnauthorized, ""},
+		{"prefix of a key", "Bearer read", read, http.StatusUnauthorized, ""},
+		{"no header", "", read, http.StatusUnauthorized, ""},
+		{"other scheme", "Basic read-key", read, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			tt.handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, tt.body, w.Body.String())
+				return
+			}
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			if tt.status == http.StatusUnauthorized {
+				assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestNewAuthenticator_RejectsInvalidKeys(t *testing.T) {
+	tests := map[string][]middlewares.APIKey{
+		"no name":        {{Key: "k", Role: middlewares.RoleReader}},
+		"empty key":      {{Name: "a", Role: middlewares.RoleReader}},
+		"unknown role":   {{Name: "a", Key: "k", Role: "owner"}},
+		"duplicate name": {{Name: "a", Key: "k1", Role: middlewares.RoleReader}, {Name: "a", Key: "k2", Role: middlewares.RoleReader}},
+		"duplicate key":  {{Name: "a", Key: "k", Role: middlewares.RoleReader}, {Name: "b", Key: "k", Role: middlewares.RoleAdmin}},
+	}
+	for name, keys := range tests {
+		_, err := middlewares.NewAuthenticator(keys)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := middlewares.ParseAPIKeys(" dashboard:reader:r1, ops:admin:a:b:c ,")
+	require.NoError(t, err)
+	assert.Equal(t, []middlewares.APIKey{
+		{Name: "dashboard", Role: middlewares.RoleReader, Key: "r1"},
+		{Name: "ops", Role: middlewares.RoleAdmin, Key: "a:b:c"},
+	}, keys)
+
+	_, err = middlewares.ParseAPIKeys("dashboard:reader:r1,secret-key")
+	assert.EqualError(t, err, "api key entry 2: expected name:role:key")
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name":"backoffice","key":"edit-key","role":"editor"}]`), 0600))
+
+	keys, err := middlewares.LoadAPIKeys(path)
+	require.NoError(t, err)
+	assert.Equal(t, []middlewares.APIKey{{Name: "backoffice", Key: "edit-key", Role: middlewares.RoleEditor}}, keys)
+}
+
+func TestAuthenticator_AcceptTokens(t *testing.T) {
+	tokens, err := token.NewHS256(&token.ConfigHS256{Secret: []byte("0123456789abcdef0123456789abcdef")})
+	require.NoError(t, err)
+	a := newTestAuthenticator(t).AcceptTokens(tokens)
+
+	var claims token.Claims
+	var principal middlewares.Principal
+	h := a.Authenticate(middlewares.RequireRole(middlewares.RoleEditor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = middlewares.ClaimsFrom(r.Context())
+		principal, _ = middlewares.PrincipalFrom(r.Context())
+	})))
+
+	serve := func(tk string) int {
+		req := httptest.NewRequest(http.MethodPost, "/products", nil)
+		req.Header.Set("Authorization", "Bearer "+tk)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	editor, _, err := tokens.Mint("pos-7", "editor", 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve(editor))
+	assert.Equal(t, "pos-7", claims.Subject)
+	assert.Equal(t, middlewares.Principal{Name: "token:pos-7", Role: middlewares.RoleEditor}, principal)
+
+	reader, _, err := tokens.Mint("pos-8", "reader", 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, serve(reader))
+
+	unknownRole, _, err := tokens.Mint("pos-9", "owner", 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serve(unknownRole))
+
+	assert.Equal(t, http.StatusUnauthorized, serve(editor[:len(editor)-2]))
+}
+
+func TestAuthenticator_AcceptClientCerts(t *testing.T) {
+	a := newTestAuthenticator(t)
+	require.NoError(t, a.AcceptClientCerts([]middlewares.ClientCert{
+		{CommonName: "store-12-till-3", Role: middlewares.RoleEditor},
+	}))
+	h := a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := middlewares.PrincipalFrom(r.Context())
+		w.Write([]byte(p.Name + " " + string(p.Role)))
+	}))
+
+	verified := func(cn string) *tls.ConnectionState {
+		leaf := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}, VerifiedChains: [][]*x509.Certificate{{leaf}}}
+	}
+	tests := []struct {
+		name          string
+		tls           *tls.ConnectionState
+		authorization string
+		status        int
+		body          string
+	}{
+		{"mapped cert", verified("store-12-till-3"), "", http.StatusOK, "cert:store-12-till-3 editor"},
+		{"unmapped cert", verified("store-99-till-1"), "", http.StatusUnauthorized, ""},
+		{"unverified cert", &tls.ConnectionState{PeerCertificates: verified("store-12-till-3").PeerCertificates}, "", http.StatusUnauthorized, ""},
+		{"key wins over cert", verified("store-12-till-3"), "Bearer read-key", http.StatusOK, "dashboard reader"},
+		{"bad key with cert", verified("store-12-till-3"), "Bearer nope", http.StatusUnauthorized, ""},
+		{"plain http", nil, "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			req.TLS = tt.tls
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthenticator_AcceptClientCertsRejectsInvalid(t *testing.T) {
+	tests := map[string][]middlewares.ClientCert{
+		"no common name": {{Role: middlewares.RoleReader}},
+		"unknown role":   {{CommonName: "a", Role: "owner"}},
+		"duplicate":      {{CommonName: "a", Role: middlewares.RoleReader}, {CommonName: "a", Role: middlewares.RoleEditor}},
+	}
+	for name, certs := range tests {
+		assert.Error(t, newTestAuthenticator(t).AcceptClientCerts(certs), name)
+	}
+}
+
+func TestParseClientCerts(t *testing.T) {
+	certs, err := middlewares.ParseClientCerts("store-1:reader, CN=till:2:editor,")
+	require.NoError(t, err)
+	assert.Equal(t, []middlewares.ClientCert{
+		{CommonName: "store-1", Role: middlewares.RoleReader},
+		{CommonName: "CN=till:2", Role: middlewares.RoleEditor},
+	}, certs)
+
+	_, err = middlewares.ParseClientCerts("store-1")
+	assert.Error(t, err)
+}
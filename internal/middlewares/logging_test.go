@@ -0,0 +1,99 @@
+package middlewares_test
+
+import (
+	"app/internal/logging"
+	"app/internal/middlewares"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := middlewares.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.GetReqID(r.Context())
+	}))
+
+	tests := []struct {
+		incoming string
+		kept     bool
+	}{
+		{"pos-7/4f1c:2", true},
+		{"", false},
+		{"has spaces", false},
+		{"new\nline", false},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("X-Request-ID", tt.incoming)
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, req)
+
+		assert.Equal(t, seen, w.Header().Get("X-Request-ID"))
+		if tt.kept {
+			assert.Equal(t, tt.incoming, seen)
+		} else {
+			assert.Len(t, seen, 32, tt.incoming)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelInfo)
+
+	auth, err := middlewares.NewAuthenticator([]middlewares.APIKey{{Name: "backoffice", Key: "edit-key", Role: middlewares.RoleEditor}})
+	require.NoError(t, err)
+
+	rt := chi.NewRouter()
+	rt.Use(middlewares.RequestID)
+	rt.Use(middlewares.AccessLog(logger))
+	rt.Route("/products", func(rt chi.Router) {
+		rt.Use(auth.Authenticate)
+		rt.Get("/{id_product}", func(w http.ResponseWriter, r *http.Request) {
+			logging.FromContext(r.Context()).Info("product read")
+			w.Write([]byte("hello"))
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/products/7", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	req.Header.Set("Authorization", "Bearer edit-key")
+	rt.ServeHTTP(httptest.NewRecorder(), req)
+
+	var lines []map[string]any
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.Len(t, lines, 2)
+
+	assert.Equal(t, "product read", lines[0]["msg"])
+	assert.Equal(t, "req-42", lines[0]["request_id"])
+	assert.Equal(t, "backoffice", lines[0]["principal"])
+
+	access := lines[1]
+	assert.Equal(t, "request", access["msg"])
+	assert.Equal(t, "req-42", access["request_id"])
+	assert.Equal(t, "backoffice", access["principal"])
+	assert.Equal(t, "GET", access["method"])
+	assert.Equal(t, "/products/7", access["path"])
+	assert.Equal(t, "/products/{id_product}", access["route"])
+	assert.Equal(t, float64(200), access["status"])
+	assert.Equal(t, float64(5), access["bytes"])
+	assert.Contains(t, access, "latency_ms")
+}
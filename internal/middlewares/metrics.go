@@ -0,0 +1,63 @@
+package middlewares
+
+import (
+	"app/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// unmatchedRoute labels requests no route matched, so scanning random paths
+// can not blow up the number of series; unknown methods become "other" for
+// the same reason.
+const unmatchedRoute = "unmatched"
+
+func NewHTTPMetrics(reg *metrics.Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: reg.NewCounterVec("http_requests_total",
+			"HTTP requests served, by route pattern, method and status.", "route", "method", "status"),
+		latency: reg.NewHistogramVec("http_request_duration_seconds",
+			"HTTP request latency, by route pattern, method and status.", metrics.DefLatencyBuckets, "route", "method", "status"),
+	}
+}
+
+// HTTPMetrics counts and times requests by chi route pattern, e.g.
+// /products/{id_product}, rather than by path.
+type HTTPMetrics struct {
+	requests *metrics.CounterVec
+	latency  *metrics.HistogramVec
+}
+
+func (m *HTTPMetrics) Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		labels := []string{route, methodLabel(r.Method), strconv.Itoa(status)}
+		m.requests.Inc(labels...)
+		m.latency.Observe(time.Since(start).Seconds(), labels...)
+	})
+}
+
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,44 @@
+package middlewares_test
+
+import (
+	"app/internal/metrics"
+	"app/internal/middlewares"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMetrics_LabelsByRoutePattern(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	rt := chi.NewRouter()
+	rt.Use(middlewares.NewHTTPMetrics(reg).Instrument)
+	rt.Route("/products", func(rt chi.Router) {
+		rt.Get("/{id_product}", func(w http.ResponseWriter, r *http.Request) {
+			if chi.URLParam(r, "id_product") == "9" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+	})
+
+	for _, path := range []string{"/products/1", "/products/2", "/products/9", "/nowhere"} {
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/products/1", nil))
+
+	var buf bytes.Buffer
+	_, err := reg.WriteTo(&buf)
+	require.NoError(t, err)
+	out := buf.String()
+
+	assert.Contains(t, out, `http_requests_total{route="/products/{id_product}",method="GET",status="200"} 2`)
+	assert.Contains(t, out, `http_requests_total{route="/products/{id_product}",method="GET",status="404"} 1`)
+	assert.Contains(t, out, `http_requests_total{route="unmatched",method="GET",status="404"} 1`)
+	assert.Contains(t, out, `method="other",status="405"} 1`)
+	assert.Contains(t, out, `http_request_duration_seconds_count{route="/products/{id_product}",method="GET",status="200"} 2`)
+}
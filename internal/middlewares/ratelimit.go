@@ -0,0 +1,312 @@
+package middlewares
+
+import (
+	"app/internal/problem"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate requests
+// per second. A negative Rate disables limiting.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type ConfigRateLimiter struct {
+	// Read limits GET, HEAD and OPTIONS requests, Write every other method.
+	Read  Limit
+	Write Limit
+	// AuthFailures limits the requests per remote IP that fail to
+	// authenticate, see LimitAuthFailures.
+	AuthFailures Limit
+	// IdleTimeout is how long a client's bucket is kept after its last
+	// request, once it has refilled.
+	IdleTimeout time.Duration
+	// Now is the clock, time.Now by default.
+	Now func() time.Time
+}
+
+func NewRateLimiter(cfg *ConfigRateLimiter) *RateLimiter {
+	defaultConfig := &ConfigRateLimiter{
+		Read:         Limit{Rate: 20, Burst: 40},
+		Write:        Limit{Rate: 5, Burst: 10},
+		AuthFailures: Limit{Rate: 0.1, Burst: 10},
+		IdleTimeout:  10 * time.Minute,
+		Now:          time.Now,
+	}
+	if cfg != nil {
+		if cfg.Read.Rate != 0 {
+			defaultConfig.Read = cfg.Read
+		}
+		if cfg.Write.Rate != 0 {
+			defaultConfig.Write = cfg.Write
+		}
+		if cfg.AuthFailures.Rate != 0 {
+			defaultConfig.AuthFailures = cfg.AuthFailures
+		}
+		if cfg.IdleTimeout > 0 {
+			defaultConfig.IdleTimeout = cfg.IdleTimeout
+		}
+		if cfg.Now != nil {
+			defaultConfig.Now = cfg.Now
+		}
+	}
+	for _, l := range []*Limit{&defaultConfig.Read, &defaultConfig.Write, &defaultConfig.AuthFailures} {
+		if l.Rate > 0 && l.Burst < 1 {
+			l.Burst = 1
+		}
+	}
+
+	l := &RateLimiter{
+		limits: [...]Limit{
+			classRead:        defaultConfig.Read,
+			classWrite:       defaultConfig.Write,
+			classAuthFailure: defaultConfig.AuthFailures,
+		},
+		idle:    defaultConfig.IdleTimeout,
+		now:     defaultConfig.Now,
+		buckets: make(map[bucketKey]*bucket),
+		done:    make(chan struct{}),
+	}
+
+	l.wg.Add(1)
+	go l.evictLoop(defaultConfig.IdleTimeout)
+
+	return l
+}
+
+// RateLimiter throttles each client with one token bucket for reads and one
+// for writes. Clients are told where they stand through the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, and get a 429 with
+// Retry-After once their bucket is empty. A third bucket per remote IP counts
+// failed authentications.
+type RateLimiter struct {
+	limits [classCount]Limit
+	idle   time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type bucketClass int
+
+const (
+	classRead bucketClass = iota
+	classWrite
+	classAuthFailure
+	classCount
+)
+
+type bucketKey struct {
+	client string
+	class  bucketClass
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limit throttles requests by client. Authenticated requests are keyed by
+// principal, so every client behind one address keeps its own quota; others
+// by remote IP. It must run after Authenticate to see the principal.
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := bucketKey{client: clientKey(r), class: classRead}
+		if !isRead(r.Method) {
+			key.class = classWrite
+		}
+		limit := l.limits[key.class]
+		if limit.Rate < 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, remaining, reset, retry := l.take(key, limit)
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(retry)))
+			problem.Write(w, r, problem.RateLimited, fmt.Sprintf("Rate limit of %d requests exceeded, retry in %d seconds.", limit.Burst, seconds(retry)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimitAuthFailures throttles guessing credentials: every 401 from the
+// handlers below takes a token from the bucket of the remote IP, and once it
+// is empty the IP gets a 429 before its credentials are even checked. The
+// bucket is only looked at on the way in, so requests that authenticate,
+// however long they run, cost nothing and clients sharing an address are
+// not throttled by each other. It must run before Authenticate.
+func (l *RateLimiter) LimitAuthFailures(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := bucketKey{client: ipKey(r), class: classAuthFailure}
+		limit := l.limits[key.class]
+		if limit.Rate < 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if allowed, retry := l.peek(key, limit); !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(retry)))
+			problem.Write(w, r, problem.RateLimited, fmt.Sprintf("Too many failed authentications, retry in %d seconds.", seconds(retry)))
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() == http.StatusUnauthorized {
+			l.take(key, limit)
+		}
+	})
+}
+
+// Buckets returns the number of buckets held, which eviction keeps bounded
+// by the number of recently active clients.
+func (l *RateLimiter) Buckets() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.buckets)
+}
+
+// Close stops evicting idle buckets.
+func (l *RateLimiter) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	l.wg.Wait()
+	return nil
+}
+
+// take refills the bucket of key and takes a token from it if there is one.
+// It returns the tokens left, the time until the bucket is full again and,
+// when refused, the time until the next token.
+func (l *RateLimiter) take(key bucketKey, limit Limit) (allowed bool, remaining int, reset, retry time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.refill(now, limit)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		allowed = true
+	} else {
+		retry = rateDuration(1-b.tokens, limit.Rate)
+	}
+
+	return allowed, int(b.tokens), rateDuration(float64(limit.Burst)-b.tokens, limit.Rate), retry
+}
+
+// peek refills the bucket of key and reports whether it has a token, without
+// taking it; when not, it returns the time until the next token. A client
+// without a bucket has a full one.
+func (l *RateLimiter) peek(key bucketKey, limit Limit) (allowed bool, retry time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return true, 0
+	}
+	b.refill(l.now(), limit)
+	if b.tokens >= 1 {
+		return true, 0
+	}
+	return false, rateDuration(1-b.tokens, limit.Rate)
+}
+
+func (b *bucket) refill(now time.Time, limit Limit) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed.Seconds()*limit.Rate)
+		b.last = now
+	}
+}
+
+// evict drops the buckets idle for longer than the idle timeout. Only full
+// buckets go: a new bucket starts full, so eviction never hands a client
+// more requests than it would have had.
+func (l *RateLimiter) evict() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, b := range l.buckets {
+		if now.Sub(b.last) < l.idle {
+			continue
+		}
+		limit := l.limits[key.class]
+		b.refill(now, limit)
+		if b.tokens >= float64(limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *RateLimiter) evictLoop(interval time.Duration) {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.evict()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func clientKey(r *http.Request) string {
+	if p, ok := PrincipalFrom(r.Context()); ok {
+		return "principal:" + p.Name
+	}
+	return ipKey(r)
+}
+
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func isRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func rateDuration(tokens, rate float64) time.Duration {
+	return time.Duration(tokens / rate * float64(time.Second))
+}
+
+// seconds rounds d up to whole seconds, as the rate limit headers expect.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
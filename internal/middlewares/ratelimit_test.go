@@ -0,0 +1,209 @@
+package middlewares_test
+
+import (
+	"app/internal/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestRateLimiter_ReadsAndWritesPerClient(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	l := middlewares.NewRateLimiter(&middlewares.ConfigRateLimiter{
+		Read:  middlewares.Limit{Rate: 1, Burst: 3},
+		Write: middlewares.Limit{Rate: 0.5, Burst: 1},
+		Now:   clock.Now,
+	})
+	defer l.Close()
+	h := l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(method, principal, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/products", nil)
+		req.RemoteAddr = addr
+		if principal != "" {
+			req = req.WithContext(middlewares.WithPrincipal(req.Context(), middlewares.Principal{Name: principal, Role: middlewares.RoleEditor}))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, remaining := range []string{"2", "1", "0"} {
+		w := serve(http.MethodGet, "scanner", "10.0.0.1:5000")
+		assert.Equal(t, http.StatusOK, w.Code, i)
+		assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, remaining, w.Header().Get("RateLimit-Remaining"))
+	}
+
+	w := serve(http.MethodGet, "scanner", "10.0.0.1:5000")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, "3", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	// Writes have their own bucket, and so do other clients on the same IP.
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "scanner", "10.0.0.1:5000").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPatch, "scanner", "10.0.0.1:5000").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "pos", "10.0.0.1:5000").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "", "10.0.0.1:5000").Code)
+
+	clock.Advance(time.Second)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "scanner", "10.0.0.1:5000").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodGet, "scanner", "10.0.0.1:5000").Code)
+
+	w = serve(http.MethodDelete, "scanner", "10.0.0.1:5000")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimiter_LimitAuthFailures(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	l := middlewares.NewRateLimiter(&middlewares.ConfigRateLimiter{
+		AuthFailures: middlewares.Limit{Rate: 0.1, Burst: 3},
+		Now:          clock.Now,
+	})
+	defer l.Close()
+	auth, err := middlewares.NewAuthenticator([]middlewares.APIKey{{Name: "pos", Key: "good", Role: middlewares.RoleReader}})
+	require.NoError(t, err)
+	h := l.LimitAuthFailures(auth.Authenticate(l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	serve := func(key, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/products", nil)
+		req.RemoteAddr = addr
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// Successes cost nothing.
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, serve("good", "10.0.0.1:5000").Code)
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, serve("guess", "10.0.0.1:5000").Code, i)
+	}
+	w := serve("guess", "10.0.0.1:5000")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	// The address is shut out, even with a good key; others are not.
+	assert.Equal(t, http.StatusTooManyRequests, serve("good", "10.0.0.1:5000").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("guess", "10.0.0.2:5000").Code)
+
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, http.StatusOK, serve("good", "10.0.0.1:5000").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("guess", "10.0.0.1:5000").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("guess", "10.0.0.1:5000").Code)
+}
+
+func TestRateLimiter_LimitAuthFailuresIgnoresRequestsInFlight(t *testing.T) {
+	l := middlewares.NewRateLimiter(&middlewares.ConfigRateLimiter{
+		AuthFailures: middlewares.Limit{Rate: 0.1, Burst: 3},
+	})
+	defer l.Close()
+	auth, err := middlewares.NewAuthenticator([]middlewares.APIKey{{Name: "pos", Key: "good", Role: middlewares.RoleReader}})
+	require.NoError(t, err)
+
+	const inFlight = 8
+	// arrived gets one signal per request, from inside the handler or, for
+	// a request turned away, once it is answered.
+	arrived := make(chan struct{}, inFlight)
+	release := make(chan struct{})
+	h := l.LimitAuthFailures(auth.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	})))
+
+	codes := make([]int, inFlight)
+	var done sync.WaitGroup
+	for i := range codes {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			req := httptest.NewRequest(http.MethodGet, "/products/export", nil)
+			req.RemoteAddr = "10.0.0.1:5000"
+			req.Header.Set("Authorization", "Bearer good")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if codes[i] = w.Code; w.Code != http.StatusOK {
+				arrived <- struct{}{}
+			}
+		}(i)
+	}
+
+	// Hold every request that got through in flight until all have arrived.
+	for range codes {
+		<-arrived
+	}
+	close(release)
+	done.Wait()
+	for i, code := range codes {
+		assert.Equal(t, http.StatusOK, code, i)
+	}
+}
+
+func TestRateLimiter_DisabledLimit(t *testing.T) {
+	l := middlewares.NewRateLimiter(&middlewares.ConfigRateLimiter{
+		Read:  middlewares.Limit{Rate: -1},
+		Write: middlewares.Limit{Rate: 1, Burst: 1},
+	})
+	defer l.Close()
+	h := l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimiter_EvictsIdleBuckets(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	l := middlewares.NewRateLimiter(&middlewares.ConfigRateLimiter{
+		Read:        middlewares.Limit{Rate: 1, Burst: 2},
+		IdleTimeout: 10 * time.Millisecond,
+		Now:         clock.Now,
+	})
+	defer l.Close()
+	h := l.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, addr := range []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1"} {
+		req := httptest.NewRequest(http.MethodGet, "/products", nil)
+		req.RemoteAddr = addr
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.Equal(t, 3, l.Buckets())
+
+	// Sweeps run, but by the limiter clock no bucket is idle yet.
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, 3, l.Buckets())
+
+	clock.Advance(time.Second)
+	assert.Eventually(t, func() bool { return l.Buckets() == 0 }, time.Second, 5*time.Millisecond)
+}
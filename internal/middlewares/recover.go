@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"app/internal/logging"
+	"app/internal/problem"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recoverer turns a panic in the handlers below into an internal problem,
+// logging the panic and its stack with the request. http.ErrAbortHandler is
+// panicked again so the server still cuts the response short. It must run
+// after AccessLog for the log to carry the request id.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			logging.FromContext(r.Context()).Error("panic", "panic", rec, "stack", string(debug.Stack()))
+			problem.Write(w, r, problem.Internal, "")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,48 @@
+package middlewares_test
+
+import (
+	"app/internal/logging"
+	"app/internal/middlewares"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverer_WritesInternalProblem(t *testing.T) {
+	var logs bytes.Buffer
+	h := middlewares.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/products/7", nil)
+	req = req.WithContext(logging.NewContext(req.Context(), logging.New(&logs, slog.LevelInfo)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"/problems/internal","title":"Internal server error","status":500,"instance":"/products/7","code":"internal"}`, w.Body.String())
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.Equal(t, "panic", line["msg"])
+	assert.Equal(t, "boom", line["panic"])
+	assert.Contains(t, line["stack"], "recover_test.go")
+}
+
+func TestRecoverer_RepanicsAbortHandler(t *testing.T) {
+	h := middlewares.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/products/export", nil)
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
@@ -0,0 +1,130 @@
+// Package problem writes RFC 9457 problem details (application/problem+json)
+// for every error response of the API.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 9457 problem details object extended with a stable code,
+// the id of the request and, for validation problems, the failing fields.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Code   `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	Errors    any    `json:"errors,omitempty"`
+}
+
+// New builds the problem registered for code, for the request r.
+func New(r *http.Request, code Code, detail string) Problem {
+	d, ok := registry[code]
+	if !ok {
+		code, d = Internal, registry[Internal]
+	}
+
+	p := Problem{
+		Type:   TypeBase + string(code),
+		Title:  d.title,
+		Status: d.status,
+		Detail: detail,
+		Code:   code,
+	}
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = middleware.GetReqID(r.Context())
+	}
+	return p
+}
+
+// Write responds with p.
+func (p Problem) Write(w http.ResponseWriter) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
+
+// Write responds with the problem registered for code.
+func Write(w http.ResponseWriter, r *http.Request, code Code, detail string) {
+	New(r, code, detail).Write(w)
+}
+
+// NotFoundHandler and MethodNotAllowedHandler replace the router's plain text
+// defaults.
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, RouteNotFound, "No route matches "+r.URL.Path+".")
+}
+
+// MethodNotAllowedHandler also lists the methods the route does serve in
+// the Allow header, as RFC 9110 requires of a 405.
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	if allowed := allowedMethods(r); len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+	}
+	Write(w, r, MethodNotAllowed, "Method "+r.Method+" is not allowed on "+r.URL.Path+".")
+}
+
+// methods are the methods allowedMethods tries, in the order they are listed.
+var methods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// allowedMethods matches the path of r against the router for every method.
+func allowedMethods(r *http.Request) (allowed []string) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return nil
+	}
+
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	for _, m := range methods {
+		if matches(rctx.Routes, m, path) {
+			allowed = append(allowed, m)
+		}
+	}
+	return allowed
+}
+
+// matches reports whether routes serve method on path. chi registers the
+// bare prefix of a mounted router for every method, so there Match alone
+// accepts anything; such a path is matched as "/" of the mounted router,
+// which is where it is routed.
+func matches(routes chi.Routes, method, path string) bool {
+	rctx := chi.NewRouteContext()
+	if !routes.Match(rctx, method, path) {
+		return false
+	}
+
+	mount := strings.TrimSuffix(rctx.RoutePattern(), "/") + "/*"
+	for _, rt := range routes.Routes() {
+		if rt.Pattern == mount && rt.SubRoutes != nil {
+			return matches(rt.SubRoutes, method, "/")
+		}
+	}
+	return true
+}
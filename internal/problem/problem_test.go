@@ -0,0 +1,43 @@
+package problem_test
+
+import (
+	"app/internal/problem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodNotAllowedHandler_SetsAllow(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	rt := chi.NewRouter()
+	rt.MethodNotAllowed(problem.MethodNotAllowedHandler)
+	rt.Get("/ping", ok)
+	rt.Route("/products", func(rt chi.Router) {
+		rt.Get("/", ok)
+		rt.Post("/", ok)
+		rt.Get("/{id}", ok)
+		rt.Put("/{id}", ok)
+		rt.Delete("/{id}", ok)
+	})
+
+	tests := []struct {
+		method, path, allow string
+	}{
+		{http.MethodPost, "/ping", "GET"},
+		{http.MethodDelete, "/products", "GET, POST"},
+		{http.MethodDelete, "/products/", "GET, POST"},
+		{http.MethodPost, "/products/7", "GET, PUT, DELETE"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+
+		rt.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code, tt.path)
+		assert.Equal(t, tt.allow, w.Header().Get("Allow"), tt.path)
+		assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"), tt.path)
+	}
+}
@@ -0,0 +1,75 @@
+package problem
+
+import "net/http"
+
+// Code identifies a class of problem. Codes are stable and meant to be
+// matched by clients; the type URI of a problem is TypeBase followed by its
+// code.
+type Code string
+
+// TypeBase prefixes every problem code to form the problem type URI.
+const TypeBase = "/problems/"
+
+// The registry of every problem the API can return. Add new codes here, with
+// their title and status, rather than writing ad hoc error bodies.
+const (
+	// BadRequest: the request is malformed, e.g. an id that is not a number,
+	// an unparseable body or an invalid query parameter.
+	BadRequest Code = "bad-request"
+	// Unauthorized: the request carries no valid credentials.
+	Unauthorized Code = "unauthorized"
+	// Forbidden: the credentials are valid but their role does not allow
+	// the request.
+	Forbidden Code = "forbidden"
+	// RouteNotFound: no route matches the request path.
+	RouteNotFound Code = "route-not-found"
+	// MethodNotAllowed: the route exists but not for this method.
+	MethodNotAllowed Code = "method-not-allowed"
+	// NotFound: the addressed resource, typically a product, does not exist.
+	NotFound Code = "not-found"
+	// Conflict: the request conflicts with the current state of a resource.
+	Conflict Code = "conflict"
+	// CodeValueExists: another product already uses the code value.
+	CodeValueExists Code = "code-value-exists"
+	// PatchTestFailed: a JSON Patch test operation did not hold.
+	PatchTestFailed Code = "patch-test-failed"
+	// UnsupportedMediaType: the body's Content-Type is not accepted here.
+	UnsupportedMediaType Code = "unsupported-media-type"
+	// RateLimited: the client used up its request quota; Retry-After says
+	// when to try again.
+	RateLimited Code = "rate-limited"
+	// ValidationFailed: the payload is well-formed but breaks product rules;
+	// the errors member lists every failing field.
+	ValidationFailed Code = "validation-failed"
+	// Internal: an unexpected failure; the detail is never exposed.
+	Internal Code = "internal"
+)
+
+type definition struct {
+	title  string
+	status int
+}
+
+var registry = map[Code]definition{
+	BadRequest:           {"Bad request", http.StatusBadRequest},
+	Unauthorized:         {"Unauthorized", http.StatusUnauthorized},
+	Forbidden:            {"Forbidden", http.StatusForbidden},
+	RouteNotFound:        {"Route not found", http.StatusNotFound},
+	MethodNotAllowed:     {"Method not allowed", http.StatusMethodNotAllowed},
+	NotFound:             {"Resource not found", http.StatusNotFound},
+	Conflict:             {"Conflict", http.StatusConflict},
+	CodeValueExists:      {"Code value already exists", http.StatusConflict},
+	PatchTestFailed:      {"Patch test failed", http.StatusConflict},
+	UnsupportedMediaType: {"Unsupported media type", http.StatusUnsupportedMediaType},
+	ValidationFailed:     {"Validation failed", http.StatusUnprocessableEntity},
+	RateLimited:          {"Too many requests", http.StatusTooManyRequests},
+	Internal:             {"Internal server error", http.StatusInternalServerError},
+}
+
+// Status returns the HTTP status registered for c.
+func (c Code) Status() int {
+	if d, ok := registry[c]; ok {
+		return d.status
+	}
+	return http.StatusInternalServerError
+}
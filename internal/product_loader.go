@@ -5,3 +5,7 @@ import "app/internal/domain"
 type ProductLoader interface {
 	Load() (v map[int]domain.Product, err error)
 }
+
+type ProductSaver interface {
+	Save(v map[int]domain.Product) (err error)
+}
@@ -1,13 +1,23 @@
 package internal
 
-import "app/internal/domain"
+import (
+	"app/internal/domain"
+	"context"
+)
 
 type ProductRepository interface {
-	FindAll() (v map[int]domain.Product, err error)
-	Create(p domain.Product) (err error)
-	GetById(id int) (p domain.Product, err error)
-	FindProducts(price float64) (p map[int]domain.Product, err error)
-	UpdateById(id int, p domain.Product) (domain.Product, error)
-	UpdateAttributesById(id int, p domain.Product) (domain.Product, error)
-	DeleteById(id int) (err error)
+	FindAll(ctx context.Context) (v map[int]domain.Product, err error)
+	FindPage(ctx context.Context, q domain.ProductPageQuery) (p []domain.Product, total int, err error)
+	Create(ctx context.Context, p domain.Product) (new domain.Product, err error)
+	GetById(ctx context.Context, id int) (p domain.Product, err error)
+	GetByCodeValue(ctx context.Context, code string) (p domain.Product, err error)
+	FindProducts(ctx context.Context, f domain.ProductFilter) (p []domain.Product, err error)
+	SearchText(ctx context.Context, q string, limit int) (p []domain.ProductMatch, err error)
+	FindByExpiration(ctx context.Context, from, to domain.Date) (p []domain.Product, err error)
+	UpdateById(ctx context.Context, id int, p domain.Product) (domain.Product, error)
+	UpdateAttributesById(ctx context.Context, id int, p domain.ProductPatcher) (domain.Product, error)
+	DeleteById(ctx context.Context, id int) (err error)
+	// Import creates the products of rows without an id and replaces the
+	// others, all or nothing, persisting the batch at once.
+	Import(ctx context.Context, rows []domain.ProductImportRow) (created, updated int, err error)
 }
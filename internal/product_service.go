@@ -1,13 +1,22 @@
 package internal
 
-import "app/internal/domain"
+import (
+	"app/internal/domain"
+	"context"
+)
 
 type ProductService interface {
-	FindAll() (p map[int]domain.Product, err error)
-	Create(p domain.Product) (err error)
-	GetById(id int) (p domain.Product, err error)
-	FindProducts(price float64) (p map[int]domain.Product, err error)
-	UpdateById(id int, p domain.Product) (domain.Product, error)
-	UpdateAttributesById(id int, p domain.Product) (domain.Product, error)
-	DeleteById(id int) (err error)
+	FindAll(ctx context.Context) (p map[int]domain.Product, err error)
+	FindPage(ctx context.Context, q domain.ProductPageQuery) (p []domain.Product, total int, err error)
+	Create(ctx context.Context, p domain.Product) (new domain.Product, err error)
+	GetById(ctx context.Context, id int) (p domain.Product, err error)
+	GetByCodeValue(ctx context.Context, code string) (p domain.Product, err error)
+	FindProducts(ctx context.Context, f domain.ProductFilter) (p []domain.Product, err error)
+	SearchText(ctx context.Context, q string, limit int) (p []domain.ProductMatch, err error)
+	FindExpiring(ctx context.Context, asOf domain.Date, days int) (p []domain.Product, err error)
+	FindExpired(ctx context.Context, asOf domain.Date) (p []domain.Product, err error)
+	UpdateById(ctx context.Context, id int, p domain.Product) (domain.Product, error)
+	UpdateAttributesById(ctx context.Context, id int, p domain.ProductPatcher) (domain.Product, error)
+	DeleteById(ctx context.Context, id int) (err error)
+	Import(ctx context.Context, rows []domain.ProductImportRow, dryRun bool) (r domain.ProductImportReport, err error)
 }
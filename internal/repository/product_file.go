@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/domain"
+	"app/internal/health"
+	"app/internal/logging"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type FlushPolicy int
+
+const (
+	// FlushEveryWrite saves the catalog before each mutating call returns.
+	FlushEveryWrite FlushPolicy = iota
+	// FlushPeriodic saves the catalog at most once per FlushInterval and
+	// again on Close.
+	FlushPeriodic
+)
+
+type ConfigProductFile struct {
+	FlushPolicy   FlushPolicy
+	FlushInterval time.Duration
+}
+
+func NewProductFile(db map[int]domain.Product, sv internal.ProductSaver, cfg *ConfigProductFile) *ProductFile {
+	defaultConfig := &ConfigProductFile{
+		FlushPolicy:   FlushEveryWrite,
+		FlushInterval: 5 * time.Second,
+	}
+	if cfg != nil {
+		defaultConfig.FlushPolicy = cfg.FlushPolicy
+		if cfg.FlushInterval > 0 {
+			defaultConfig.FlushInterval = cfg.FlushInterval
+		}
+	}
+
+	f := &ProductFile{
+		ProductMap: NewProductMap(db),
+		sv:         sv,
+		policy:     defaultConfig.FlushPolicy,
+		done:       make(chan struct{}),
+	}
+
+	if f.policy == FlushPeriodic {
+		f.wg.Add(1)
+		go f.flushLoop(defaultConfig.FlushInterval)
+	}
+
+	return f
+}
+
+// ProductFile is a ProductMap whose contents are written back through a
+// ProductSaver. Reads are served from memory; mutations bump version and are
+// persisted according to the flush policy. Under FlushEveryWrite a mutation
+// whose save fails is undone in memory and fails; under FlushPeriodic changes
+// live only in memory until the next successful flush.
+type ProductFile struct {
+	*ProductMap
+	sv     internal.ProductSaver
+	policy FlushPolicy
+
+	// writeMu serializes mutations with their save, so a failed save undoes
+	// only its own change.
+	writeMu sync.Mutex
+
+	// flushMu serializes snapshots and saves so an older snapshot can never
+	// overwrite a newer one.
+	flushMu  sync.Mutex
+	version  atomic.Int64
+	flushed  int64
+	flushErr error
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func (f *ProductFile) Create(ctx context.Context, p domain.Product) (domain.Product, error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	p, err := f.ProductMap.Create(ctx, p)
+	if err != nil {
+		return p, err
+	}
+	if err = f.changed(p.Id, domain.Product{}, false); err != nil {
+		return domain.Product{}, err
+	}
+	return p, nil
+}
+
+func (f *ProductFile) UpdateById(ctx context.Context, id int, p domain.Product) (domain.Product, error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	prev, _ := f.ProductMap.lookup(id)
+	p, err := f.ProductMap.UpdateById(ctx, id, p)
+	if err != nil {
+		return p, err
+	}
+	if err = f.changed(id, prev, true); err != nil {
+		return domain.Product{}, err
+	}
+	return p, nil
+}
+
+func (f *ProductFile) UpdateAttributesById(ctx context.Context, id int, p domain.ProductPatcher) (domain.Product, error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	prev, _ := f.ProductMap.lookup(id)
+	r, err := f.ProductMap.UpdateAttributesById(ctx, id, p)
+	if err != nil {
+		return r, err
+	}
+	if err = f.changed(id, prev, true); err != nil {
+		return domain.Product{}, err
+	}
+	return r, nil
+}
+
+func (f *ProductFile) DeleteById(ctx context.Context, id int) error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	prev, _ := f.ProductMap.lookup(id)
+	if err := f.ProductMap.DeleteById(ctx, id); err != nil {
+		return err
+	}
+	return f.changed(id, prev, true)
+}
+
+// Import applies rows like ProductMap.Import and saves the catalog once for
+// the whole batch; under FlushEveryWrite a failed save undoes every row.
+func (f *ProductFile) Import(ctx context.Context, rows []domain.ProductImportRow) (created, updated int, err error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	_, changes, err := f.ProductMap.apply(rows)
+	if err != nil {
+		return
+	}
+	if err = f.flushChanges(changes); err != nil {
+		return
+	}
+	created, updated = countImport(rows)
+	return
+}
+
+// Flush saves the catalog if it changed since the last successful save.
+func (f *ProductFile) Flush() (err error) {
+	f.flushMu.Lock()
+	defer f.flushMu.Unlock()
+	defer func() { f.flushErr = err }()
+
+	version := f.version.Load()
+	if version == f.flushed {
+		return nil
+	}
+
+	db, err := f.ProductMap.FindAll(context.Background())
+	if err != nil {
+		return
+	}
+
+	if err = f.sv.Save(db); err != nil {
+		return
+	}
+	f.flushed = version
+
+	return nil
+}
+
+// RegisterChecks registers the ProductMap checks and store_writable, which
+// fails while the last save failed or the saver could not write now.
+func (f *ProductFile) RegisterChecks(r *health.Registry) {
+	f.ProductMap.RegisterChecks(r)
+	r.Register("store_writable", func(context.Context) error {
+		f.flushMu.Lock()
+		err := f.flushErr
+		f.flushMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("last save failed: %w", err)
+		}
+		return writable(f.sv)
+	})
+}
+
+// Close stops the periodic flusher and performs a final flush.
+func (f *ProductFile) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
+	f.wg.Wait()
+
+	return f.Flush()
+}
+
+// changed records a change to product id already applied in memory and,
+// under FlushEveryWrite, saves it. If the save fails, the product is put back
+// to prev, or removed when existed is false.
+func (f *ProductFile) changed(id int, prev domain.Product, existed bool) error {
+	return f.flushChanges([]productChange{{id: id, prev: prev, existed: existed}})
+}
+
+// flushChanges is changed for several changes, undone newest first.
+func (f *ProductFile) flushChanges(changes []productChange) error {
+	f.version.Add(1)
+	if f.policy != FlushEveryWrite {
+		return nil
+	}
+	if err := f.Flush(); err != nil {
+		for i := len(changes) - 1; i >= 0; i-- {
+			c := changes[i]
+			f.ProductMap.restore(c.id, c.prev, c.existed)
+		}
+		return err
+	}
+	return nil
+}
+
+func (f *ProductFile) flushLoop(interval time.Duration) {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.Flush(); err != nil {
+				logging.FromContext(context.Background()).Error("catalog flush failed", "error", err)
+			}
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// writableSaver is implemented by the savers that can tell whether a save
+// would succeed without saving, such as the JSON file loader.
+type writableSaver interface {
+	Writable() error
+}
+
+func writable(sv internal.ProductSaver) error {
+	if w, ok := sv.(writableSaver); ok {
+		return w.Writable()
+	}
+	return nil
+}
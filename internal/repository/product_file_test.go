@@ -0,0 +1,243 @@
+package repository_test
+
+import (
+	"app/internal/domain"
+	"app/internal/health"
+	"app/internal/loader"
+	"app/internal/repository"
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingSaver struct {
+	mu    sync.Mutex
+	saves int
+	last  map[int]domain.Product
+	err   error
+}
+
+func (s *countingSaver) Save(v map[int]domain.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.saves++
+	s.last = v
+	return nil
+}
+
+func (s *countingSaver) snapshot() (int, map[int]domain.Product) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves, s.last
+}
+
+func TestProductFile_EveryWritePersistsEachMutation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "products.json")
+	ld := loader.NewProductJSONFile(path)
+	require.NoError(t, ld.Save(map[int]domain.Product{1: {Id: 1, Name: "Seed"}}))
+	db, err := ld.Load()
+	require.NoError(t, err)
+
+	rp := repository.NewProductFile(db, ld, nil)
+	created, err := rp.Create(ctx, domain.Product{Name: "Created"})
+	require.NoError(t, err)
+	_, err = rp.UpdateAttributesById(ctx, 1, domain.ProductPatch{Name: ptr("Patched")})
+	require.NoError(t, err)
+
+	// No Close: simulates the process dying right after the requests returned.
+	reloaded, err := loader.NewProductJSONFile(path).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "Patched", reloaded[1].Name)
+	assert.Equal(t, "Created", reloaded[created.Id].Name)
+
+	require.NoError(t, rp.DeleteById(ctx, 1))
+	reloaded, err = loader.NewProductJSONFile(path).Load()
+	require.NoError(t, err)
+	assert.NotContains(t, reloaded, 1)
+}
+
+func TestProductFile_ReadsDoNotFlush(t *testing.T) {
+	ctx := context.Background()
+	sv := &countingSaver{}
+	rp := repository.NewProductFile(map[int]domain.Product{1: {Id: 1}}, sv, nil)
+
+	_, _ = rp.FindAll(ctx)
+	_, _ = rp.GetById(ctx, 1)
+	_, _ = rp.GetById(ctx, 2)
+	_ = rp.DeleteById(ctx, 2)
+	require.NoError(t, rp.Close())
+
+	saves, _ := sv.snapshot()
+	assert.Equal(t, 0, saves)
+}
+
+func TestProductFile_PeriodicFlushBatchesWrites(t *testing.T) {
+	ctx := context.Background()
+	sv := &countingSaver{}
+	rp := repository.NewProductFile(nil, sv, &repository.ConfigProductFile{
+		FlushPolicy:   repository.FlushPeriodic,
+		FlushInterval: 20 * time.Millisecond,
+	})
+	defer rp.Close()
+
+	for i := 0; i < 10; i++ {
+		_, err := rp.Create(ctx, domain.Product{Name: "Batch"})
+		require.NoError(t, err)
+	}
+	saves, _ := sv.snapshot()
+	assert.Equal(t, 0, saves)
+
+	assert.Eventually(t, func() bool {
+		saves, last := sv.snapshot()
+		return saves == 1 && len(last) == 10
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestProductFile_CloseFlushesPendingWrites(t *testing.T) {
+	ctx := context.Background()
+	sv := &countingSaver{}
+	rp := repository.NewProductFile(nil, sv, &repository.ConfigProductFile{
+		FlushPolicy:   repository.FlushPeriodic,
+		FlushInterval: time.Hour,
+	})
+
+	_, err := rp.Create(ctx, domain.Product{Name: "Pending"})
+	require.NoError(t, err)
+	require.NoError(t, rp.Close())
+
+	saves, last := sv.snapshot()
+	assert.Equal(t, 1, saves)
+	assert.Equal(t, "Pending", last[1].Name)
+}
+
+func TestProductFile_FailedSaveUndoesTheChange(t *testing.T) {
+	ctx := context.Background()
+	sv := &countingSaver{}
+	rp := repository.NewProductFile(map[int]domain.Product{
+		1: {Id: 1, Name: "Saved", CodeValue: "S1"},
+	}, sv, nil)
+	sv.err = errors.New("disk full")
+
+	_, err := rp.Create(ctx, domain.Product{Name: "Unsaved"})
+	assert.EqualError(t, err, "disk full")
+	_, err = rp.UpdateById(ctx, 1, domain.Product{Name: "Renamed", CodeValue: "S2"})
+	assert.EqualError(t, err, "disk full")
+	err = rp.DeleteById(ctx, 1)
+	assert.EqualError(t, err, "disk full")
+
+	all, err := rp.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]domain.Product{1: {Id: 1, Name: "Saved", CodeValue: "S1"}}, all)
+	p, err := rp.GetByCodeValue(ctx, "S1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Id)
+
+	sv.mu.Lock()
+	sv.err = nil
+	sv.mu.Unlock()
+	p, err = rp.Create(ctx, domain.Product{Name: "Saved later"})
+	require.NoError(t, err)
+
+	saves, last := sv.snapshot()
+	assert.Equal(t, 1, saves)
+	assert.Equal(t, "Saved later", last[p.Id].Name)
+	assert.Len(t, last, 2)
+}
+
+func TestProductFile_ImportSavesOnce(t *testing.T) {
+	ctx := context.Background()
+	sv := &countingSaver{}
+	rp := repository.NewProductFile(map[int]domain.Product{1: {Id: 1, Name: "Seed"}}, sv, nil)
+
+	rows := make([]domain.ProductImportRow, 0, 50)
+	for i := 0; i < 50; i++ {
+		rows = append(rows, domain.ProductImportRow{Line: i + 2, Product: domain.Product{Name: "Imported", Price: 1}})
+	}
+	created, updated, err := rp.Import(ctx, rows)
+	require.NoError(t, err)
+	assert.Equal(t, 50, created)
+	assert.Equal(t, 0, updated)
+
+	saves, last := sv.snapshot()
+	assert.Equal(t, 1, saves)
+	assert.Len(t, last, 51)
+}
+
+func TestProductFile_FailedImportSaveUndoesTheBatch(t *testing.T) {
+	ctx := context.Background()
+	sv := &countingSaver{err: errors.New("disk full")}
+	seed := map[int]domain.Product{1: {Id: 1, Name: "Seed", CodeValue: "S1"}}
+	rp := repository.NewProductFile(map[int]domain.Product{1: seed[1]}, sv, nil)
+
+	_, _, err := rp.Import(ctx, []domain.ProductImportRow{
+		{Line: 2, Product: domain.Product{Id: 1, Name: "Renamed", CodeValue: "S2"}},
+		{Line: 3, Product: domain.Product{Name: "Created", CodeValue: "S1"}},
+	})
+	assert.EqualError(t, err, "disk full")
+
+	all, err := rp.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, seed, all)
+	p, err := rp.GetByCodeValue(ctx, "S1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Id)
+}
+
+func TestProductFile_ConcurrentWritesEndConsistent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "products.json")
+	ld := loader.NewProductJSONFile(path)
+	rp := repository.NewProductFile(nil, ld, nil)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				_, err := rp.Create(ctx, domain.Product{Name: "Concurrent"})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, rp.Close())
+
+	reloaded, err := ld.Load()
+	require.NoError(t, err)
+	assert.Len(t, reloaded, 160)
+}
+
+func TestProductFile_StoreWritableCheck(t *testing.T) {
+	ctx := context.Background()
+	sv := &countingSaver{err: errors.New("disk full")}
+	rp := repository.NewProductFile(nil, sv, nil)
+	reg := health.NewRegistry(nil)
+	rp.RegisterChecks(reg)
+
+	report := reg.Run(ctx)
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Contains(t, report.Checks, "repository")
+
+	_, err := rp.Create(ctx, domain.Product{Name: "Unsaved"})
+	require.Error(t, err)
+	report = reg.Run(ctx)
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, "last save failed: disk full", report.Checks["store_writable"].Error)
+
+	sv.mu.Lock()
+	sv.err = nil
+	sv.mu.Unlock()
+	require.NoError(t, rp.Flush())
+	assert.Equal(t, health.StatusUp, reg.Run(ctx).Status)
+}
@@ -0,0 +1,472 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/domain"
+	"app/internal/fsutil"
+	"app/internal/health"
+	"app/internal/logging"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	journalOpSeq              = "seq"
+	journalOpCreate           = "create"
+	journalOpUpdate           = "update"
+	journalOpUpdateAttributes = "update_attributes"
+	journalOpDelete           = "delete"
+	journalOpImport           = "import"
+)
+
+// journalRecord is one line of the journal. Product holds the state of the
+// product after the operation, so replaying a record is idempotent. A seq
+// record carries the highest id ever assigned, which the snapshot alone can
+// not tell once that product was deleted. An import record holds every
+// product of the batch in one line, so a crash keeps all of it or none.
+type journalRecord struct {
+	Op       string           `json:"op"`
+	Id       int              `json:"id"`
+	Product  *domain.Product  `json:"product,omitempty"`
+	Products []domain.Product `json:"products,omitempty"`
+}
+
+type ConfigProductJournal struct {
+	JournalPath string
+	// CompactEvery triggers a compaction after that many appended records.
+	CompactEvery int
+	// CompactInterval compacts pending records periodically; a negative
+	// value disables it.
+	CompactInterval time.Duration
+	// NoSync skips fsync after each append, trading durability for speed.
+	NoSync bool
+}
+
+// NewProductJournal replays the journal at cfg.JournalPath over db, the last
+// snapshot returned by the loader, and opens the journal for appending.
+// Snapshots are written back through sv.
+func NewProductJournal(db map[int]domain.Product, sv internal.ProductSaver, cfg *ConfigProductJournal) (j *ProductJournal, err error) {
+	defaultConfig := &ConfigProductJournal{
+		CompactEvery:    1000,
+		CompactInterval: time.Minute,
+	}
+	if cfg != nil {
+		defaultConfig.JournalPath = cfg.JournalPath
+		if cfg.CompactEvery > 0 {
+			defaultConfig.CompactEvery = cfg.CompactEvery
+		}
+		if cfg.CompactInterval != 0 {
+			defaultConfig.CompactInterval = cfg.CompactInterval
+		}
+		defaultConfig.NoSync = cfg.NoSync
+	}
+	if defaultConfig.JournalPath == "" {
+		return nil, errors.New("journal path is required")
+	}
+
+	if db == nil {
+		db = make(map[int]domain.Product)
+	}
+	lastId, records, err := replayJournal(defaultConfig.JournalPath, db)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(defaultConfig.JournalPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+
+	j = &ProductJournal{
+		ProductMap:   NewProductMap(db),
+		sv:           sv,
+		path:         defaultConfig.JournalPath,
+		file:         file,
+		records:      records,
+		compactEvery: defaultConfig.CompactEvery,
+		sync:         !defaultConfig.NoSync,
+		done:         make(chan struct{}),
+	}
+	if lastId > j.lastId {
+		j.lastId = lastId
+	}
+
+	if defaultConfig.CompactInterval > 0 {
+		j.wg.Add(1)
+		go j.compactLoop(defaultConfig.CompactInterval)
+	}
+
+	return j, nil
+}
+
+// ProductJournal is a ProductMap backed by an append-only journal on top of a
+// snapshot. Every mutation is appended to the journal before it returns; a
+// mutation whose record cannot be appended is undone in memory and fails, so
+// the catalog never serves a change the journal lacks. Compaction writes a
+// fresh snapshot and starts an empty journal.
+type ProductJournal struct {
+	*ProductMap
+	sv   internal.ProductSaver
+	path string
+
+	// mu serializes mutations with their journal append, so the journal order
+	// always matches the order the changes were applied in memory.
+	mu           sync.Mutex
+	file         *os.File
+	records      int
+	compactEvery int
+	sync         bool
+	// writeErr is the outcome of the last append or compaction.
+	writeErr error
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func (j *ProductJournal) Create(ctx context.Context, p domain.Product) (r domain.Product, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	r, err = j.ProductMap.Create(ctx, p)
+	if err != nil {
+		return
+	}
+	if err = j.persist(ctx, journalRecord{Op: journalOpCreate, Id: r.Id, Product: &r}, domain.Product{}, false); err != nil {
+		return domain.Product{}, err
+	}
+	return r, nil
+}
+
+func (j *ProductJournal) UpdateById(ctx context.Context, id int, p domain.Product) (r domain.Product, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	prev, _ := j.ProductMap.lookup(id)
+	r, err = j.ProductMap.UpdateById(ctx, id, p)
+	if err != nil {
+		return
+	}
+	if err = j.persist(ctx, journalRecord{Op: journalOpUpdate, Id: id, Product: &r}, prev, true); err != nil {
+		return domain.Product{}, err
+	}
+	return r, nil
+}
+
+func (j *ProductJournal) UpdateAttributesById(ctx context.Context, id int, p domain.ProductPatcher) (r domain.Product, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	prev, _ := j.ProductMap.lookup(id)
+	r, err = j.ProductMap.UpdateAttributesById(ctx, id, p)
+	if err != nil {
+		return
+	}
+	if err = j.persist(ctx, journalRecord{Op: journalOpUpdateAttributes, Id: id, Product: &r}, prev, true); err != nil {
+		return domain.Product{}, err
+	}
+	return r, nil
+}
+
+func (j *ProductJournal) DeleteById(ctx context.Context, id int) (err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	prev, _ := j.ProductMap.lookup(id)
+	if err = j.ProductMap.DeleteById(ctx, id); err != nil {
+		return
+	}
+	return j.persist(ctx, journalRecord{Op: journalOpDelete, Id: id}, prev, true)
+}
+
+// Import applies rows like ProductMap.Import as a single journal record; if
+// it cannot be appended, every row is undone.
+func (j *ProductJournal) Import(ctx context.Context, rows []domain.ProductImportRow) (created, updated int, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	stored, changes, err := j.ProductMap.apply(rows)
+	if err != nil {
+		return
+	}
+
+	var lastId int
+	for _, p := range stored {
+		lastId = max(lastId, p.Id)
+	}
+	if err = j.append(journalRecord{Op: journalOpImport, Id: lastId, Products: stored}); err != nil {
+		for i := len(changes) - 1; i >= 0; i-- {
+			c := changes[i]
+			j.ProductMap.restore(c.id, c.prev, c.existed)
+		}
+		return
+	}
+	j.compactIfDue(ctx)
+
+	created, updated = countImport(rows)
+	return
+}
+
+// Compact saves the current catalog as a new snapshot and truncates the
+// journal. A crash in between is harmless: the old journal replays cleanly
+// over the new snapshot because every record carries the resulting state.
+func (j *ProductJournal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.compact(context.Background())
+}
+
+// Flush forces appended records to stable storage.
+func (j *ProductJournal) Flush() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Sync()
+}
+
+// RegisterChecks registers the ProductMap checks and store_writable, which
+// fails while the journal is closed, the last append or compaction failed,
+// or the snapshot could not be written now.
+func (j *ProductJournal) RegisterChecks(r *health.Registry) {
+	j.ProductMap.RegisterChecks(r)
+	r.Register("store_writable", func(context.Context) error {
+		j.mu.Lock()
+		closed, err := j.file == nil, j.writeErr
+		j.mu.Unlock()
+		switch {
+		case closed:
+			return errors.New("journal is closed")
+		case err != nil:
+			return fmt.Errorf("last journal write failed: %w", err)
+		}
+		return writable(j.sv)
+	})
+}
+
+// Close stops periodic compaction, compacts pending records and closes the
+// journal. The repository must not be used afterwards.
+func (j *ProductJournal) Close() (err error) {
+	j.closeOnce.Do(func() {
+		close(j.done)
+	})
+	j.wg.Wait()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	if j.records > 0 {
+		err = j.compact(context.Background())
+	}
+	if cerr := j.file.Close(); err == nil {
+		err = cerr
+	}
+	j.file = nil
+
+	return
+}
+
+// persist appends rec for a change already applied in memory. If the append
+// fails, the product is put back to prev, or removed when existed is false.
+// Once appended the change is durable, so a compaction failing afterwards is
+// only logged and left to the next one.
+func (j *ProductJournal) persist(ctx context.Context, rec journalRecord, prev domain.Product, existed bool) error {
+	if err := j.append(rec); err != nil {
+		j.ProductMap.restore(rec.Id, prev, existed)
+		return err
+	}
+	j.compactIfDue(ctx)
+
+	return nil
+}
+
+func (j *ProductJournal) compactIfDue(ctx context.Context) {
+	if j.records < j.compactEvery {
+		return
+	}
+	if err := j.compact(ctx); err != nil {
+		logging.FromContext(ctx).Error("journal compaction failed", "error", err)
+	}
+}
+
+// append writes rec to the journal. On failure whatever part of it reached
+// the file is cut off again.
+func (j *ProductJournal) append(rec journalRecord) (err error) {
+	defer func() { j.writeErr = err }()
+
+	if j.file == nil {
+		return errors.New("journal is closed")
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+
+	info, err := j.file.Stat()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, j.file.Truncate(info.Size()))
+		}
+	}()
+
+	if _, err = j.file.Write(b); err != nil {
+		return
+	}
+	if j.sync {
+		if err = j.file.Sync(); err != nil {
+			return
+		}
+	}
+
+	j.records++
+	return nil
+}
+
+func (j *ProductJournal) compact(ctx context.Context) (err error) {
+	defer func() { j.writeErr = err }()
+
+	db, err := j.ProductMap.FindAll(ctx)
+	if err != nil {
+		return
+	}
+	if err = j.sv.Save(db); err != nil {
+		return
+	}
+
+	j.ProductMap.mu.RLock()
+	seq := journalRecord{Op: journalOpSeq, Id: j.ProductMap.lastId}
+	j.ProductMap.mu.RUnlock()
+
+	b, err := json.Marshal(seq)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+
+	if err = fsutil.WriteFileAtomic(j.path, b); err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	j.file.Close()
+	j.file = file
+	logging.FromContext(ctx).Info("journal compacted", "records", j.records, "products", len(db))
+	j.records = 0
+
+	return nil
+}
+
+func (j *ProductJournal) compactLoop(interval time.Duration) {
+	defer j.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			j.mu.Lock()
+			if j.file != nil && j.records > 0 {
+				if err := j.compact(context.Background()); err != nil {
+					logging.FromContext(context.Background()).Error("journal compaction failed", "error", err)
+				}
+			}
+			j.mu.Unlock()
+		case <-j.done:
+			return
+		}
+	}
+}
+
+// replayJournal applies the records at path to db and returns the highest id
+// seen and the number of records replayed. A missing journal is empty. A torn
+// last line, left by a crash mid-append, is discarded and cut off the file.
+func replayJournal(path string, db map[int]domain.Product) (lastId int, records int, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var (
+		offset int64
+		line   int
+		rd     = bufio.NewReader(file)
+	)
+	for {
+		b, readErr := rd.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return 0, 0, readErr
+		}
+		if len(b) == 0 {
+			break
+		}
+		line++
+
+		complete := b[len(b)-1] == '\n'
+		var rec journalRecord
+		if err = json.Unmarshal(bytes.TrimSpace(b), &rec); err != nil || !complete {
+			if readErr == io.EOF {
+				// Torn tail: drop it so new records start on a clean line.
+				return lastId, records, file.Truncate(offset)
+			}
+			return 0, 0, fmt.Errorf("journal %s line %d: %w", filepath.Base(path), line, err)
+		}
+
+		switch rec.Op {
+		case journalOpSeq:
+		case journalOpCreate, journalOpUpdate, journalOpUpdateAttributes:
+			if rec.Product == nil {
+				return 0, 0, fmt.Errorf("journal %s line %d: %s record without product", filepath.Base(path), line, rec.Op)
+			}
+			db[rec.Id] = *rec.Product
+		case journalOpDelete:
+			delete(db, rec.Id)
+		case journalOpImport:
+			for _, p := range rec.Products {
+				db[p.Id] = p
+			}
+		default:
+			return 0, 0, fmt.Errorf("journal %s line %d: unknown op %q", filepath.Base(path), line, rec.Op)
+		}
+		if rec.Id > lastId {
+			lastId = rec.Id
+		}
+		if rec.Op != journalOpSeq {
+			records++
+		}
+
+		offset += int64(len(b))
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	return lastId, records, nil
+}
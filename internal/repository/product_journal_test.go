@@ -0,0 +1,241 @@
+package repository_test
+
+import (
+	"app/internal/domain"
+	"app/internal/health"
+	"app/internal/loader"
+	"app/internal/repository"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type journalFixture struct {
+	snapshot string
+	journal  string
+	ld       *loader.ProductJSONFile
+}
+
+func newJournalFixture(t *testing.T, seed map[int]domain.Product) journalFixture {
+	dir := t.TempDir()
+	f := journalFixture{
+		snapshot: filepath.Join(dir, "products.json"),
+		journal:  filepath.Join(dir, "products.json.journal"),
+	}
+	f.ld = loader.NewProductJSONFile(f.snapshot)
+	require.NoError(t, f.ld.Save(seed))
+	return f
+}
+
+func (f journalFixture) open(t *testing.T, compactEvery int) *repository.ProductJournal {
+	db, err := f.ld.Load()
+	require.NoError(t, err)
+	rp, err := repository.NewProductJournal(db, f.ld, &repository.ConfigProductJournal{
+		JournalPath:     f.journal,
+		CompactEvery:    compactEvery,
+		CompactInterval: -1,
+	})
+	require.NoError(t, err)
+	return rp
+}
+
+func TestProductJournal_ReplaysJournalOverSnapshot(t *testing.T) {
+	ctx := context.Background()
+	f := newJournalFixture(t, map[int]domain.Product{
+		1: {Id: 1, Name: "One"},
+		2: {Id: 2, Name: "Two"},
+	})
+
+	rp := f.open(t, 100)
+	created, err := rp.Create(ctx, domain.Product{Name: "Three"})
+	require.NoError(t, err)
+	_, err = rp.UpdateById(ctx, 1, domain.Product{Name: "One v2"})
+	require.NoError(t, err)
+	_, err = rp.UpdateAttributesById(ctx, created.Id, domain.ProductPatch{Price: ptr(4.5)})
+	require.NoError(t, err)
+	require.NoError(t, rp.DeleteById(ctx, 2))
+
+	// The snapshot is untouched until compaction.
+	snapshot, err := f.ld.Load()
+	require.NoError(t, err)
+	assert.Len(t, snapshot, 2)
+
+	// Reopen without Close, as after a crash.
+	reopened := f.open(t, 100)
+	defer reopened.Close()
+	all, err := reopened.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]domain.Product{
+		1: {Id: 1, Name: "One v2"},
+		3: {Id: 3, Name: "Three", Price: 4.5},
+	}, all)
+}
+
+func TestProductJournal_ReplaysImportAsOneRecord(t *testing.T) {
+	ctx := context.Background()
+	f := newJournalFixture(t, map[int]domain.Product{1: {Id: 1, Name: "One"}})
+
+	rp := f.open(t, 100)
+	created, updated, err := rp.Import(ctx, []domain.ProductImportRow{
+		{Line: 2, Product: domain.Product{Id: 1, Name: "One v2"}},
+		{Line: 3, Product: domain.Product{Name: "Two"}},
+		{Line: 4, Product: domain.Product{Name: "Three"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, created)
+	assert.Equal(t, 1, updated)
+
+	b, err := os.ReadFile(f.journal)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(b), "\n"))
+
+	reopened := f.open(t, 100)
+	defer reopened.Close()
+	all, err := reopened.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]domain.Product{
+		1: {Id: 1, Name: "One v2"},
+		2: {Id: 2, Name: "Two"},
+		3: {Id: 3, Name: "Three"},
+	}, all)
+	next, err := reopened.Create(ctx, domain.Product{Name: "Four"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, next.Id)
+}
+
+func TestProductJournal_CompactsIntoLoaderSnapshot(t *testing.T) {
+	ctx := context.Background()
+	f := newJournalFixture(t, map[int]domain.Product{1: {Id: 1, Name: "One"}})
+
+	rp := f.open(t, 3)
+	for i := 0; i < 3; i++ {
+		_, err := rp.Create(ctx, domain.Product{Name: "New"})
+		require.NoError(t, err)
+	}
+
+	snapshot, err := f.ld.Load()
+	require.NoError(t, err)
+	assert.Len(t, snapshot, 4)
+
+	journal, err := os.ReadFile(f.journal)
+	require.NoError(t, err)
+	assert.Equal(t, `{"op":"seq","id":4}`+"\n", string(journal))
+	require.NoError(t, rp.Close())
+}
+
+func TestProductJournal_DeletedIdsAreNotReusedAfterCompaction(t *testing.T) {
+	ctx := context.Background()
+	f := newJournalFixture(t, map[int]domain.Product{1: {Id: 1}})
+
+	rp := f.open(t, 100)
+	created, err := rp.Create(ctx, domain.Product{Name: "Temporary"})
+	require.NoError(t, err)
+	require.NoError(t, rp.DeleteById(ctx, created.Id))
+	require.NoError(t, rp.Compact())
+
+	reopened := f.open(t, 100)
+	defer reopened.Close()
+	next, err := reopened.Create(ctx, domain.Product{Name: "Next"})
+	require.NoError(t, err)
+	assert.Equal(t, created.Id+1, next.Id)
+}
+
+func TestProductJournal_DiscardsTornTail(t *testing.T) {
+	ctx := context.Background()
+	f := newJournalFixture(t, map[int]domain.Product{})
+
+	rp := f.open(t, 100)
+	_, err := rp.Create(ctx, domain.Product{Name: "Kept"})
+	require.NoError(t, err)
+
+	file, err := os.OpenFile(f.journal, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"op":"create","id":2,"product":{"id":2,"na`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	reopened := f.open(t, 100)
+	all, err := reopened.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	_, err = reopened.Create(ctx, domain.Product{Name: "After crash"})
+	require.NoError(t, err)
+	require.NoError(t, reopened.Flush())
+
+	journal, err := os.ReadFile(f.journal)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(journal), "\n"), "\n")
+	assert.Len(t, lines, 2)
+}
+
+func TestProductJournal_RejectsCorruptRecord(t *testing.T) {
+	f := newJournalFixture(t, map[int]domain.Product{})
+	require.NoError(t, os.WriteFile(f.journal, []byte("not json\n{\"op\":\"seq\",\"id\":1}\n"), 0644))
+
+	db, err := f.ld.Load()
+	require.NoError(t, err)
+	_, err = repository.NewProductJournal(db, f.ld, &repository.ConfigProductJournal{JournalPath: f.journal})
+
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestProductJournal_CloseCompactsPendingRecords(t *testing.T) {
+	ctx := context.Background()
+	f := newJournalFixture(t, map[int]domain.Product{})
+
+	rp := f.open(t, 100)
+	_, err := rp.Create(ctx, domain.Product{Name: "Pending"})
+	require.NoError(t, err)
+	require.NoError(t, rp.Close())
+
+	snapshot, err := f.ld.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "Pending", snapshot[1].Name)
+
+	_, err = rp.Create(ctx, domain.Product{})
+	assert.Error(t, err)
+}
+
+func TestProductJournal_FailedAppendUndoesTheChange(t *testing.T) {
+	ctx := context.Background()
+	f := newJournalFixture(t, map[int]domain.Product{
+		1: {Id: 1, Name: "Kept", CodeValue: "K1"},
+	})
+	rp := f.open(t, 100)
+	require.NoError(t, rp.Close())
+
+	_, err := rp.Create(ctx, domain.Product{Name: "Lost"})
+	assert.EqualError(t, err, "journal is closed")
+	_, err = rp.UpdateById(ctx, 1, domain.Product{Name: "Renamed"})
+	assert.EqualError(t, err, "journal is closed")
+	err = rp.DeleteById(ctx, 1)
+	assert.EqualError(t, err, "journal is closed")
+
+	all, err := rp.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]domain.Product{1: {Id: 1, Name: "Kept", CodeValue: "K1"}}, all)
+	matches, err := rp.SearchText(ctx, "kept", 0)
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func TestProductJournal_StoreWritableCheck(t *testing.T) {
+	ctx := context.Background()
+	f := newJournalFixture(t, nil)
+	rp := f.open(t, 100)
+	reg := health.NewRegistry(nil)
+	rp.RegisterChecks(reg)
+
+	assert.Equal(t, health.StatusUp, reg.Run(ctx).Status)
+
+	require.NoError(t, rp.Close())
+	report := reg.Run(ctx)
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, "journal is closed", report.Checks["store_writable"].Error)
+}
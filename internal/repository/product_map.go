@@ -2,7 +2,11 @@ package repository
 
 import (
 	"app/internal/domain"
-	"errors"
+	"app/internal/health"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
 )
 
 func NewProductMap(db map[int]domain.Product) *ProductMap {
@@ -10,15 +14,61 @@ func NewProductMap(db map[int]domain.Product) *ProductMap {
 	if db != nil {
 		defaultDb = db
 	}
-	return &ProductMap{db: defaultDb}
+
+	var lastId int
+	codes := make(map[string]int, len(defaultDb))
+	ids := make([]int, 0, len(defaultDb))
+	names := newTextIndex()
+	for id, p := range defaultDb {
+		ids = append(ids, id)
+		names.add(id, p.Name)
+		if id > lastId {
+			lastId = id
+		}
+		if p.CodeValue == "" {
+			continue
+		}
+		if other, ok := codes[p.CodeValue]; !ok || id < other {
+			codes[p.CodeValue] = id
+		}
+	}
+
+	sort.Ints(ids)
+
+	return &ProductMap{db: defaultDb, ids: ids, codes: codes, names: names, lastId: lastId}
 }
 
+// ProductMap is an in-memory product repository. All access to db goes
+// through mu, so a single ProductMap can be shared by concurrent handlers.
+// lastId is the highest id ever assigned; it only grows, so ids freed by
+// DeleteById are never handed out again. ids holds every key of db in
+// ascending order, which lets FindPage serve id-ordered pages without
+// touching the rest of the catalog. codes indexes non-empty code values to
+// their product id and names is the full-text index over product names.
 type ProductMap struct {
-	db map[int]domain.Product
+	mu     sync.RWMutex
+	db     map[int]domain.Product
+	ids    []int
+	codes  map[string]int
+	names  *textIndex
+	lastId int
+}
+
+// RegisterChecks registers repository, which fails while the catalog is
+// locked for longer than the check timeout.
+func (m *ProductMap) RegisterChecks(r *health.Registry) {
+	r.Register("repository", func(context.Context) error {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		return nil
+	})
 }
 
-func (m *ProductMap) FindAll() (p map[int]domain.Product, err error) {
-	p = make(map[int]domain.Product)
+func (m *ProductMap) FindAll(ctx context.Context) (p map[int]domain.Product, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p = make(map[int]domain.Product, len(m.db))
 
 	for key, value := range m.db {
 		p[key] = value
@@ -27,135 +77,424 @@ func (m *ProductMap) FindAll() (p map[int]domain.Product, err error) {
 	return
 }
 
-func (m *ProductMap) Create(p domain.Product) (err error) {
-	var new domain.Product
+// Stats returns the number of products and the value of the stock, the sum
+// of quantity times price.
+func (m *ProductMap) Stats() (products int, stockValue float64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	id := len(m.db) + 1
+	for _, p := range m.db {
+		stockValue += float64(p.Quantity) * p.Price
+	}
 
-	new.Id = id
-	new.CodeValue = p.CodeValue
-	new.Name = p.Name
-	new.Expiration = p.Expiration
-	new.IsPublished = p.IsPublished
-	new.Price = p.Price
-	new.Quantity = p.Quantity
+	return len(m.db), stockValue
+}
 
-	if m.db[id].Id != 0 {
-		return errors.New("ID already exists.")
+// FindPage returns one page of products in q.Sort order along with the size
+// of the whole catalog. Only the products on the page are copied.
+func (m *ProductMap) FindPage(ctx context.Context, q domain.ProductPageQuery) (p []domain.Product, total int, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := m.ids
+	if !q.Sort.ById() {
+		ids = make([]int, len(m.ids))
+		copy(ids, m.ids)
+		sort.Slice(ids, func(i, j int) bool {
+			return q.Sort.Compare(m.db[ids[i]], m.db[ids[j]]) < 0
+		})
 	}
 
-	m.db[id] = new
+	start := q.Offset
+	if q.After != nil {
+		start = sort.Search(len(ids), func(i int) bool {
+			return q.Sort.Compare(m.db[ids[i]], *q.After) > 0
+		})
+	}
+	start = min(max(start, 0), len(ids))
 
-	return nil
+	end := len(ids)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, len(ids))
+	}
+
+	p = make([]domain.Product, 0, end-start)
+	for _, id := range ids[start:end] {
+		p = append(p, m.db[id])
+	}
+
+	return p, len(ids), nil
 }
 
-func (m *ProductMap) GetById(id int) (p domain.Product, err error) {
-	var found domain.Product
-	for _, value := range m.db {
-		if value.Id == id {
-			found = value
-		}
+func (m *ProductMap) Create(ctx context.Context, p domain.Product) (new domain.Product, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.codeTaken(p.CodeValue, 0) {
+		return domain.Product{}, domain.ErrCodeValueExists
 	}
 
-	if found.Id == 0 {
-		return domain.Product{}, errors.New("ID not found.")
+	return m.insert(p), nil
+}
+
+func (m *ProductMap) GetById(ctx context.Context, id int) (p domain.Product, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.db[id]
+	if !ok {
+		return domain.Product{}, domain.ProductNotFound(id)
 	}
 
-	return found, nil
+	return p, nil
 }
 
-func (m *ProductMap) FindProducts(price float64) (p map[int]domain.Product, err error) {
-	p = make(map[int]domain.Product)
+func (m *ProductMap) GetByCodeValue(ctx context.Context, code string) (p domain.Product, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.codes[code]
+	if !ok {
+		return domain.Product{}, domain.Errorf(domain.ErrNotFound, "Code value %s not found.", code)
+	}
 
-	for key, pr := range m.db {
-		if pr.Price > price {
-			p[key] = pr
+	return m.db[id], nil
+}
+
+// FindProducts returns the products matching f in id order. No match is an
+// empty result, not an error.
+func (m *ProductMap) FindProducts(ctx context.Context, f domain.ProductFilter) (p []domain.Product, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p = make([]domain.Product, 0)
+
+	for _, id := range m.ids {
+		if pr := m.db[id]; f.Match(pr) {
+			p = append(p, pr)
 		}
 	}
 
-	if len(p) == 0 {
-		return p, errors.New("Not found.")
+	return p, nil
+}
+
+// SearchText ranks the products whose name matches q, best first, ties by
+// id. At most limit matches are returned when limit is positive.
+func (m *ProductMap) SearchText(ctx context.Context, q string, limit int) (p []domain.ProductMatch, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scores := m.names.search(q)
+	p = make([]domain.ProductMatch, 0, len(scores))
+	for id, score := range scores {
+		p = append(p, domain.ProductMatch{Product: m.db[id], Score: score})
+	}
+
+	sort.Slice(p, func(i, j int) bool {
+		if p[i].Score != p[j].Score {
+			return p[i].Score > p[j].Score
+		}
+		return p[i].Id < p[j].Id
+	})
+	if limit > 0 && len(p) > limit {
+		p = p[:limit]
 	}
 
 	return p, nil
 }
 
-func (m *ProductMap) DeleteById(id int) (err error) {
-	list := make(map[int]domain.Product)
-	var found bool
-	for key, value := range m.db {
-		if value.Id != id {
-			list[key] = value
-		} else {
-			found = true
+// FindByExpiration returns the products expiring in [from, to). A zero bound
+// leaves that side open; products without an expiration never match.
+func (m *ProductMap) FindByExpiration(ctx context.Context, from, to domain.Date) (p []domain.Product, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p = make([]domain.Product, 0)
+
+	for _, pr := range m.db {
+		if pr.Expiration.IsZero() {
+			continue
+		}
+		if !from.IsZero() && pr.Expiration.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !pr.Expiration.Before(to) {
+			continue
 		}
+		p = append(p, pr)
 	}
 
-	m.db = map[int]domain.Product{}
-	m.db = list
+	return p, nil
+}
+
+func (m *ProductMap) DeleteById(ctx context.Context, id int) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.db[id]
+	if !ok {
+		return domain.ProductNotFound(id)
+	}
 
-	if !found {
-		return errors.New("ID not found.")
+	delete(m.db, id)
+	if i := sort.SearchInts(m.ids, id); i < len(m.ids) && m.ids[i] == id {
+		m.ids = append(m.ids[:i], m.ids[i+1:]...)
 	}
+	m.setCode(id, p.CodeValue, "")
+	m.names.remove(id)
 
-	return err
+	return nil
 }
 
-func (m *ProductMap) UpdateById(id int, p domain.Product) (r domain.Product, err error) {
-	var found bool
-	for key, value := range m.db {
-		if value.Id == id {
-			m.db[key] = p
-			r = m.db[key]
-			found = true
-		}
+func (m *ProductMap) UpdateById(ctx context.Context, id int, p domain.Product) (r domain.Product, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.db[id]
+	if !ok {
+		return r, domain.ProductNotFound(id)
 	}
 
-	if !found {
-		return r, errors.New("ID not found.")
+	if m.codeTaken(p.CodeValue, id) {
+		return r, domain.ErrCodeValueExists
 	}
 
-	return r, err
+	return m.replace(id, old, p), nil
 }
 
-func (m *ProductMap) UpdateAttributesById(id int, p domain.Product) (r domain.Product, err error) {
-	var found bool
-	for key, value := range m.db {
-		if value.Id == id {
-			product := m.db[key]
+func (m *ProductMap) UpdateAttributesById(ctx context.Context, id int, p domain.ProductPatcher) (r domain.Product, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-			if p.CodeValue != "" {
-				product.CodeValue = p.CodeValue
-			}
+	old, ok := m.db[id]
+	if !ok {
+		return r, domain.ProductNotFound(id)
+	}
 
-			if p.Quantity != 0 {
-				product.Quantity = p.Quantity
-			}
+	product, err := p.Apply(old)
+	if err != nil {
+		return r, err
+	}
+	product.Id = id
 
-			if p.Price != 0 {
-				product.Price = p.Price
-			}
+	if m.codeTaken(product.CodeValue, id) {
+		return r, domain.ErrCodeValueExists
+	}
 
-			if p.IsPublished != product.IsPublished {
-				product.IsPublished = p.IsPublished
-			}
+	m.db[id] = product
+	m.setCode(id, old.CodeValue, product.CodeValue)
+	if old.Name != product.Name {
+		m.names.add(id, product.Name)
+	}
+
+	return product, nil
+}
+
+// Import creates the products of rows without an id and replaces the others,
+// in order and all or nothing: every row is checked first, as if the rows
+// before it were applied, and the first that fails is reported with its line
+// while the catalog stays untouched.
+func (m *ProductMap) Import(ctx context.Context, rows []domain.ProductImportRow) (created, updated int, err error) {
+	if _, _, err = m.apply(rows); err != nil {
+		return
+	}
+	created, updated = countImport(rows)
+	return
+}
+
+// productChange is the state of a product before a change, to undo it with
+// restore.
+type productChange struct {
+	id      int
+	prev    domain.Product
+	existed bool
+}
+
+// apply runs Import under a single write lock and returns the products as
+// stored and the changes made, oldest first.
+func (m *ProductMap) apply(rows []domain.ProductImportRow) (stored []domain.Product, changes []productChange, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err = m.checkImport(rows); err != nil {
+		return nil, nil, err
+	}
+
+	stored = make([]domain.Product, 0, len(rows))
+	changes = make([]productChange, 0, len(rows))
+	for _, row := range rows {
+		p := row.Product
+		if p.Id == 0 {
+			p = m.insert(p)
+			changes = append(changes, productChange{id: p.Id})
+		} else {
+			old := m.db[p.Id]
+			p = m.replace(p.Id, old, p)
+			changes = append(changes, productChange{id: p.Id, prev: old, existed: true})
+		}
+		stored = append(stored, p)
+	}
 
-			if p.Expiration != "" {
-				product.Expiration = p.Expiration
+	return stored, changes, nil
+}
+
+// checkImport finds the first row of rows that could not be applied after
+// the ones before it. Callers must hold mu.
+func (m *ProductMap) checkImport(rows []domain.ProductImportRow) error {
+	// codes and owned overlay m.codes and the code values of the products
+	// the rows change.
+	codes := make(map[string]int)
+	owned := make(map[int]string)
+	codeOf := func(id int) string {
+		if code, ok := owned[id]; ok {
+			return code
+		}
+		return m.db[id].CodeValue
+	}
+	ownerOf := func(code string) (int, bool) {
+		if id, ok := codes[code]; ok {
+			return id, id != 0
+		}
+		id, ok := m.codes[code]
+		return id, ok
+	}
+
+	nextId := m.lastId
+	for _, row := range rows {
+		id := row.Product.Id
+		if id == 0 {
+			nextId++
+			id = nextId
+		} else {
+			if _, ok := m.db[id]; !ok {
+				return fmt.Errorf("line %d: %w", row.Line, domain.ProductNotFound(id))
+			}
+			if old := codeOf(id); old != "" {
+				if owner, ok := ownerOf(old); ok && owner == id {
+					codes[old] = 0
+				}
 			}
+		}
 
-			if p.Name != "" {
-				product.Name = p.Name
+		code := row.Product.CodeValue
+		if code != "" {
+			if owner, ok := ownerOf(code); ok && owner != id {
+				return fmt.Errorf("line %d: %w", row.Line, domain.ErrCodeValueExists)
 			}
+			codes[code] = id
+		}
+		owned[id] = code
+	}
+
+	return nil
+}
 
-			m.db[key] = product
-			found = true
+// insert stores p under the next id. Callers must hold the write lock.
+func (m *ProductMap) insert(p domain.Product) (new domain.Product) {
+	id := m.lastId + 1
+
+	new.Id = id
+	new.CodeValue = p.CodeValue
+	new.Name = p.Name
+	new.Expiration = p.Expiration
+	new.IsPublished = p.IsPublished
+	new.Price = p.Price
+	new.Quantity = p.Quantity
+
+	m.db[id] = new
+	m.ids = append(m.ids, id)
+	m.setCode(id, "", new.CodeValue)
+	m.names.add(id, new.Name)
+	m.lastId = id
+
+	return new
+}
+
+// replace stores p under id in place of old. Callers must hold the write
+// lock.
+func (m *ProductMap) replace(id int, old, p domain.Product) domain.Product {
+	p.Id = id
+	m.db[id] = p
+	m.setCode(id, old.CodeValue, p.CodeValue)
+	if old.Name != p.Name {
+		m.names.add(id, p.Name)
+	}
+	return p
+}
+
+func countImport(rows []domain.ProductImportRow) (created, updated int) {
+	for _, row := range rows {
+		if row.Product.Id == 0 {
+			created++
+		} else {
+			updated++
 		}
 	}
+	return
+}
 
-	if !found {
-		return r, errors.New("ID not found.")
+// codeTaken reports whether code belongs to a product other than id.
+// Callers must hold mu.
+func (m *ProductMap) codeTaken(code string, id int) bool {
+	if code == "" {
+		return false
+	}
+	owner, ok := m.codes[code]
+	return ok && owner != id
+}
+
+// setCode moves the index entry of product id from old to new. Callers must
+// hold the write lock.
+func (m *ProductMap) setCode(id int, old, new string) {
+	if old == new {
+		return
+	}
+	if old != "" && m.codes[old] == id {
+		delete(m.codes, old)
+	}
+	if new != "" {
+		m.codes[new] = id
+	}
+}
+
+// lookup returns product id and whether it exists, for a caller about to
+// change it that may need to restore it.
+func (m *ProductMap) lookup(id int) (p domain.Product, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok = m.db[id]
+	return
+}
+
+// restore undoes a change to product id that could not be persisted, putting
+// back prev or, when existed is false, removing the product. lastId is left
+// alone, so an id once handed out is still never reused.
+func (m *ProductMap) restore(id int, prev domain.Product, existed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur, ok := m.db[id]
+	if ok {
+		m.setCode(id, cur.CodeValue, "")
+		m.names.remove(id)
 	}
 
-	return r, err
+	i := sort.SearchInts(m.ids, id)
+	if !existed {
+		delete(m.db, id)
+		if ok && i < len(m.ids) && m.ids[i] == id {
+			m.ids = append(m.ids[:i], m.ids[i+1:]...)
+		}
+		return
+	}
+
+	if !ok {
+		m.ids = append(m.ids, 0)
+		copy(m.ids[i+1:], m.ids[i:])
+		m.ids[i] = id
+	}
+	m.db[id] = prev
+	m.setCode(id, "", prev.CodeValue)
+	m.names.add(id, prev.Name)
 }
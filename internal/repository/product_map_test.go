@@ -0,0 +1,484 @@
+package repository_test
+
+import (
+	"app/internal/domain"
+	"app/internal/repository"
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	stressWorkers    = 16
+	stressIterations = 200
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func newSeededProductMap(n int) *repository.ProductMap {
+	db := make(map[int]domain.Product, n)
+	for i := 1; i <= n; i++ {
+		db[i] = domain.Product{
+			Id:        i,
+			Name:      "Product " + strconv.Itoa(i),
+			Quantity:  i,
+			CodeValue: "CODE" + strconv.Itoa(i),
+			Price:     float64(i),
+		}
+	}
+	return repository.NewProductMap(db)
+}
+
+func TestProductMap_ConcurrentAllMethods(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(100)
+
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < stressIterations; i++ {
+				id := (w*stressIterations+i)%100 + 1
+				switch i % 11 {
+				case 0:
+					_, _ = rp.FindAll(ctx)
+				case 1:
+					_, _ = rp.Create(ctx, domain.Product{Name: "New", Price: 1})
+				case 2:
+					_, _ = rp.GetById(ctx, id)
+				case 3:
+					_, _ = rp.FindProducts(ctx, priceAbove(50))
+				case 4:
+					_, _ = rp.UpdateById(ctx, id, domain.Product{Name: "Updated", Price: 2})
+				case 5:
+					_, _ = rp.UpdateAttributesById(ctx, id, domain.ProductPatch{Quantity: ptr(7)})
+				case 6:
+					_ = rp.DeleteById(ctx, id)
+				case 7:
+					_, _ = rp.GetByCodeValue(ctx, "CODE"+strconv.Itoa(id))
+				case 8:
+					_, _ = rp.FindByExpiration(ctx, domain.Date{}, domain.NewDate(2022, time.January, 1))
+				case 9:
+					_, _, _ = rp.FindPage(ctx, domain.ProductPageQuery{Limit: 10, Offset: id})
+				case 10:
+					_, _ = rp.SearchText(ctx, "produ", 5)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	all, err := rp.FindAll(ctx)
+	require.NoError(t, err)
+	for key, p := range all {
+		assert.Equal(t, key, p.Id)
+	}
+}
+
+func TestProductMap_ConcurrentUpdateAttributesIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(1)
+
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressIterations; i++ {
+				_, err := rp.UpdateAttributesById(ctx, 1, domain.ProductPatch{Name: ptr("Renamed")})
+				assert.NoError(t, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressIterations; i++ {
+				_, err := rp.UpdateAttributesById(ctx, 1, domain.ProductPatch{Price: ptr(9.5)})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	p, err := rp.GetById(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", p.Name)
+	assert.Equal(t, 9.5, p.Price)
+	assert.Equal(t, "CODE1", p.CodeValue)
+}
+
+func TestProductMap_ConcurrentDeleteSucceedsOnce(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(1)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		successes int
+	)
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := rp.DeleteById(ctx, 1); err == nil {
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, successes)
+	_, err := rp.GetById(ctx, 1)
+	assert.Error(t, err)
+}
+
+func TestProductMap_UpdateAttributesReturnsUpdatedProduct(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(2)
+
+	p, err := rp.UpdateAttributesById(ctx, 2, domain.ProductPatch{Name: ptr("Changed")})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, p.Id)
+	assert.Equal(t, "Changed", p.Name)
+	assert.Equal(t, "CODE2", p.CodeValue)
+}
+
+func TestProductMap_CreateNeverReusesIds(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(500)
+	require.NoError(t, rp.DeleteById(ctx, 3))
+	require.NoError(t, rp.DeleteById(ctx, 500))
+
+	p, err := rp.Create(ctx, domain.Product{Name: "After delete"})
+
+	require.NoError(t, err)
+	assert.Equal(t, 501, p.Id)
+	assert.Equal(t, "After delete", p.Name)
+}
+
+func TestProductMap_ConcurrentCreateAssignsUniqueIds(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(0)
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		ids = make(map[int]bool)
+	)
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressIterations; i++ {
+				p, err := rp.Create(ctx, domain.Product{Name: "New"})
+				assert.NoError(t, err)
+				mu.Lock()
+				ids[p.Id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, ids, stressWorkers*stressIterations)
+}
+
+func TestProductMap_CodeValueIsUnique(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(2)
+
+	_, err := rp.Create(ctx, domain.Product{CodeValue: "CODE1"})
+	assert.ErrorIs(t, err, domain.ErrCodeValueExists)
+
+	_, err = rp.UpdateById(ctx, 2, domain.Product{CodeValue: "CODE1"})
+	assert.ErrorIs(t, err, domain.ErrCodeValueExists)
+
+	_, err = rp.UpdateAttributesById(ctx, 2, domain.ProductPatch{CodeValue: ptr("CODE1")})
+	assert.ErrorIs(t, err, domain.ErrCodeValueExists)
+
+	_, err = rp.UpdateById(ctx, 1, domain.Product{CodeValue: "CODE1", Name: "Same code"})
+	assert.NoError(t, err)
+}
+
+func TestProductMap_GetByCodeValueFollowsChanges(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(2)
+
+	_, err := rp.UpdateAttributesById(ctx, 1, domain.ProductPatch{CodeValue: ptr("NEW1")})
+	require.NoError(t, err)
+
+	_, err = rp.GetByCodeValue(ctx, "CODE1")
+	assert.Error(t, err)
+	p, err := rp.GetByCodeValue(ctx, "NEW1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Id)
+
+	require.NoError(t, rp.DeleteById(ctx, 1))
+	_, err = rp.GetByCodeValue(ctx, "NEW1")
+	assert.Error(t, err)
+
+	created, err := rp.Create(ctx, domain.Product{CodeValue: "NEW1"})
+	require.NoError(t, err)
+	p, err = rp.GetByCodeValue(ctx, "NEW1")
+	require.NoError(t, err)
+	assert.Equal(t, created.Id, p.Id)
+}
+
+func TestProductMap_FindByExpirationIsHalfOpen(t *testing.T) {
+	ctx := context.Background()
+	rp := repository.NewProductMap(map[int]domain.Product{
+		1: {Id: 1, Expiration: domain.NewDate(2021, time.December, 9)},
+		2: {Id: 2, Expiration: domain.NewDate(2021, time.December, 10)},
+		3: {Id: 3, Expiration: domain.NewDate(2021, time.December, 17)},
+		4: {Id: 4},
+	})
+
+	p, err := rp.FindByExpiration(ctx, domain.NewDate(2021, time.December, 10), domain.NewDate(2021, time.December, 17))
+	require.NoError(t, err)
+	require.Len(t, p, 1)
+	assert.Equal(t, 2, p[0].Id)
+
+	p, err = rp.FindByExpiration(ctx, domain.Date{}, domain.NewDate(2021, time.December, 10))
+	require.NoError(t, err)
+	require.Len(t, p, 1)
+	assert.Equal(t, 1, p[0].Id)
+}
+
+func TestProductMap_UpdateAttributesSetsZeroValues(t *testing.T) {
+	ctx := context.Background()
+	rp := repository.NewProductMap(map[int]domain.Product{
+		1: {Id: 1, Name: "Milk", Quantity: 12, IsPublished: true, Price: 3.5},
+	})
+
+	p, err := rp.UpdateAttributesById(ctx, 1, domain.ProductPatch{Quantity: ptr(0), IsPublished: ptr(false)})
+
+	require.NoError(t, err)
+	assert.Equal(t, domain.Product{Id: 1, Name: "Milk", Quantity: 0, IsPublished: false, Price: 3.5}, p)
+}
+
+func TestProductMap_FindPageById(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(10)
+	require.NoError(t, rp.DeleteById(ctx, 4))
+
+	p, total, err := rp.FindPage(ctx, domain.ProductPageQuery{Limit: 3, Offset: 2})
+
+	require.NoError(t, err)
+	assert.Equal(t, 9, total)
+	assert.Equal(t, []int{3, 5, 6}, productIds(p))
+
+	p, _, err = rp.FindPage(ctx, domain.ProductPageQuery{Limit: 3, After: &domain.Product{Id: 3}})
+	require.NoError(t, err)
+	assert.Equal(t, []int{5, 6, 7}, productIds(p))
+
+	p, _, err = rp.FindPage(ctx, domain.ProductPageQuery{Limit: 3, Offset: 20})
+	require.NoError(t, err)
+	assert.Empty(t, p)
+}
+
+func TestProductMap_FindPageSortedWithKeyset(t *testing.T) {
+	ctx := context.Background()
+	rp := repository.NewProductMap(map[int]domain.Product{
+		1: {Id: 1, Name: "b", Price: 2},
+		2: {Id: 2, Name: "a", Price: 1},
+		3: {Id: 3, Name: "c", Price: 2},
+		4: {Id: 4, Name: "c", Price: 2},
+		5: {Id: 5, Name: "a", Price: 3},
+	})
+	sort, err := domain.ParseProductSort("price,-name")
+	require.NoError(t, err)
+
+	p, total, err := rp.FindPage(ctx, domain.ProductPageQuery{Sort: sort, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 5, total)
+	assert.Equal(t, []int{2, 3}, productIds(p))
+
+	p, _, err = rp.FindPage(ctx, domain.ProductPageQuery{Sort: sort, Limit: 2, After: &p[1]})
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 1}, productIds(p))
+
+	p, _, err = rp.FindPage(ctx, domain.ProductPageQuery{Sort: sort, Limit: 2, After: &p[1]})
+	require.NoError(t, err)
+	assert.Equal(t, []int{5}, productIds(p))
+}
+
+func productIds(p []domain.Product) []int {
+	ids := make([]int, len(p))
+	for i, pr := range p {
+		ids[i] = pr.Id
+	}
+	return ids
+}
+
+func priceAbove(price float64) domain.ProductFilter {
+	c, _ := domain.NewProductCondition("price", domain.FilterGt, strconv.FormatFloat(price, 'f', -1, 64))
+	return domain.ProductFilter{Conditions: []domain.ProductCondition{c}}
+}
+
+func TestProductMap_FindProductsEmptyResultIsNotAnError(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(3)
+
+	p, err := rp.FindProducts(ctx, priceAbove(100))
+
+	require.NoError(t, err)
+	assert.NotNil(t, p)
+	assert.Empty(t, p)
+}
+
+func TestProductMap_FindProductsCombinesConditions(t *testing.T) {
+	ctx := context.Background()
+	rp := repository.NewProductMap(map[int]domain.Product{
+		1: {Id: 1, Name: "Cookie - Oatmeal", CodeValue: "M7157", Quantity: 130, Expiration: domain.NewDate(2022, time.January, 28), Price: 275.47},
+		2: {Id: 2, Name: "Oil - Margarine", CodeValue: "S82254D", Quantity: 439, IsPublished: true, Expiration: domain.NewDate(2021, time.December, 15), Price: 71.42},
+		3: {Id: 3, Name: "Wine - Merlot", CodeValue: "T65812", Quantity: 367, Price: 179.23},
+	})
+	cond := func(field string, op domain.FilterOp, raw string) domain.ProductCondition {
+		c, err := domain.NewProductCondition(field, op, raw)
+		require.NoError(t, err)
+		return c
+	}
+
+	p, err := rp.FindProducts(ctx, domain.ProductFilter{Conditions: []domain.ProductCondition{
+		cond("price", domain.FilterGte, "100"),
+		cond("quantity", domain.FilterLte, "300"),
+		cond("name", domain.FilterContains, "OAT"),
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, productIds(p))
+
+	p, err = rp.FindProducts(ctx, domain.ProductFilter{Any: true, Conditions: []domain.ProductCondition{
+		cond("code_value", domain.FilterPrefix, "t6"),
+		cond("is_published", domain.FilterEq, "true"),
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, productIds(p))
+
+	p, err = rp.FindProducts(ctx, domain.ProductFilter{Conditions: []domain.ProductCondition{
+		cond("expiration", domain.FilterGte, "01/01/2022"),
+		cond("expiration", domain.FilterLt, "2022-02-01"),
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, productIds(p))
+}
+
+func TestProductMap_SearchTextRanksFullMatchesFirst(t *testing.T) {
+	ctx := context.Background()
+	rp := repository.NewProductMap(map[int]domain.Product{
+		1: {Id: 1, Name: "Cookie - Oatmeal"},
+		2: {Id: 2, Name: "Oats - Rolled"},
+		3: {Id: 3, Name: "Cookies - Chocolate Chip"},
+		4: {Id: 4, Name: "Wine - Red Oakridge Merlot"},
+	})
+
+	p, err := rp.SearchText(ctx, "oat cookie", 0)
+
+	require.NoError(t, err)
+	require.Len(t, p, 3)
+	assert.Equal(t, 1, p[0].Id)
+	assert.Greater(t, p[0].Score, p[1].Score)
+	assert.ElementsMatch(t, []int{2, 3}, productIds([]domain.Product{p[1].Product, p[2].Product}))
+}
+
+func TestProductMap_SearchTextFoldsCaseAndAccents(t *testing.T) {
+	ctx := context.Background()
+	rp := repository.NewProductMap(map[int]domain.Product{
+		1: {Id: 1, Name: "Crème Brûlée"},
+		2: {Id: 2, Name: "Jalapeño Peppers"},
+	})
+
+	p, err := rp.SearchText(ctx, "CREME brul", 0)
+	require.NoError(t, err)
+	require.Len(t, p, 1)
+	assert.Equal(t, 1, p[0].Id)
+
+	p, err = rp.SearchText(ctx, "jalapeno", 0)
+	require.NoError(t, err)
+	require.Len(t, p, 1)
+	assert.Equal(t, 2, p[0].Id)
+}
+
+func TestProductMap_SearchTextFollowsMutations(t *testing.T) {
+	ctx := context.Background()
+	rp := repository.NewProductMap(map[int]domain.Product{
+		1: {Id: 1, Name: "Flour - Rye"},
+	})
+
+	created, err := rp.Create(ctx, domain.Product{Name: "Flour - Spelt"})
+	require.NoError(t, err)
+	_, err = rp.UpdateAttributesById(ctx, 1, domain.ProductPatch{Name: ptr("Bread - Rye")})
+	require.NoError(t, err)
+
+	p, err := rp.SearchText(ctx, "flour", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{created.Id}, matchIds(p))
+
+	p, err = rp.SearchText(ctx, "rye", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, matchIds(p))
+
+	require.NoError(t, rp.DeleteById(ctx, created.Id))
+	p, err = rp.SearchText(ctx, "spe", 0)
+	require.NoError(t, err)
+	assert.Empty(t, p)
+}
+
+func matchIds(p []domain.ProductMatch) []int {
+	ids := make([]int, len(p))
+	for i, m := range p {
+		ids[i] = m.Id
+	}
+	return ids
+}
+
+func TestProductMap_ImportIsAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	rp := newSeededProductMap(2)
+
+	// Moving a code value to a new product works when its owner lets go of
+	// it first; the last row takes a code value still in use.
+	_, _, err := rp.Import(ctx, []domain.ProductImportRow{
+		{Line: 2, Product: domain.Product{Id: 1, Name: "Renamed", CodeValue: "NEW1", Price: 1}},
+		{Line: 3, Product: domain.Product{Name: "Created", CodeValue: "CODE1", Price: 1}},
+		{Line: 4, Product: domain.Product{Name: "Clash", CodeValue: "CODE2", Price: 1}},
+	})
+	assert.ErrorIs(t, err, domain.ErrCodeValueExists)
+	assert.ErrorContains(t, err, "line 4")
+
+	all, err := rp.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, "Product 1", all[1].Name)
+	p, err := rp.GetByCodeValue(ctx, "CODE1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Id)
+
+	_, _, err = rp.Import(ctx, []domain.ProductImportRow{
+		{Line: 2, Product: domain.Product{Id: 9, Name: "Missing", Price: 1}},
+	})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	created, updated, err := rp.Import(ctx, []domain.ProductImportRow{
+		{Line: 2, Product: domain.Product{Id: 1, Name: "Renamed", CodeValue: "NEW1", Price: 1}},
+		{Line: 3, Product: domain.Product{Name: "Created", CodeValue: "CODE1", Price: 1}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 1, updated)
+	p, err = rp.GetByCodeValue(ctx, "CODE1")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Product{Id: 3, Name: "Created", CodeValue: "CODE1", Price: 1}, p)
+	p, err = rp.GetByCodeValue(ctx, "NEW1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Id)
+}
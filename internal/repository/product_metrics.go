@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/domain"
+	"app/internal/metrics"
+	"context"
+	"time"
+)
+
+// productStats is implemented by the repositories that can size the catalog
+// without copying it; ProductMap and everything built on it.
+type productStats interface {
+	Stats() (products int, stockValue float64)
+}
+
+// NewProductMetrics wraps rp so every call is counted and timed in reg, and
+// registers the catalog size and stock value gauges.
+func NewProductMetrics(rp internal.ProductRepository, reg *metrics.Registry) *ProductMetrics {
+	m := &ProductMetrics{
+		rp: rp,
+		calls: reg.NewCounterVec("repository_operations_total",
+			"Product repository calls, by method and outcome (ok or error).", "method", "outcome"),
+		latency: reg.NewHistogramVec("repository_operation_duration_seconds",
+			"Product repository call latency, by method.", metrics.FastLatencyBuckets, "method"),
+	}
+
+	stats := func() (int, float64) {
+		if s, ok := rp.(productStats); ok {
+			return s.Stats()
+		}
+		db, err := rp.FindAll(context.Background())
+		if err != nil {
+			return 0, 0
+		}
+		var value float64
+		for _, p := range db {
+			value += float64(p.Quantity) * p.Price
+		}
+		return len(db), value
+	}
+	reg.NewGaugeFunc("catalog_products", "Products in the catalog.", func() float64 {
+		n, _ := stats()
+		return float64(n)
+	})
+	reg.NewGaugeFunc("catalog_stock_value", "Sum of quantity times price over the catalog.", func() float64 {
+		_, v := stats()
+		return v
+	})
+
+	return m
+}
+
+// ProductMetrics is a ProductRepository decorator recording metrics.
+type ProductMetrics struct {
+	rp      internal.ProductRepository
+	calls   *metrics.CounterVec
+	latency *metrics.HistogramVec
+}
+
+func (m *ProductMetrics) observe(method string, start time.Time, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.calls.Inc(method, outcome)
+	m.latency.Observe(time.Since(start).Seconds(), method)
+}
+
+func (m *ProductMetrics) FindAll(ctx context.Context) (v map[int]domain.Product, err error) {
+	start := time.Now()
+	v, err = m.rp.FindAll(ctx)
+	m.observe("FindAll", start, err)
+	return
+}
+
+func (m *ProductMetrics) FindPage(ctx context.Context, q domain.ProductPageQuery) (p []domain.Product, total int, err error) {
+	start := time.Now()
+	p, total, err = m.rp.FindPage(ctx, q)
+	m.observe("FindPage", start, err)
+	return
+}
+
+func (m *ProductMetrics) Create(ctx context.Context, p domain.Product) (new domain.Product, err error) {
+	start := time.Now()
+	new, err = m.rp.Create(ctx, p)
+	m.observe("Create", start, err)
+	return
+}
+
+func (m *ProductMetrics) GetById(ctx context.Context, id int) (p domain.Product, err error) {
+	start := time.Now()
+	p, err = m.rp.GetById(ctx, id)
+	m.observe("GetById", start, err)
+	return
+}
+
+func (m *ProductMetrics) GetByCodeValue(ctx context.Context, code string) (p domain.Product, err error) {
+	start := time.Now()
+	p, err = m.rp.GetByCodeValue(ctx, code)
+	m.observe("GetByCodeValue", start, err)
+	return
+}
+
+func (m *ProductMetrics) FindProducts(ctx context.Context, f domain.ProductFilter) (p []domain.Product, err error) {
+	start := time.Now()
+	p, err = m.rp.FindProducts(ctx, f)
+	m.observe("FindProducts", start, err)
+	return
+}
+
+func (m *ProductMetrics) SearchText(ctx context.Context, q string, limit int) (p []domain.ProductMatch, err error) {
+	start := time.Now()
+	p, err = m.rp.SearchText(ctx, q, limit)
+	m.observe("SearchText", start, err)
+	return
+}
+
+func (m *ProductMetrics) FindByExpiration(ctx context.Context, from, to domain.Date) (p []domain.Product, err error) {
+	start := time.Now()
+	p, err = m.rp.FindByExpiration(ctx, from, to)
+	m.observe("FindByExpiration", start, err)
+	return
+}
+
+func (m *ProductMetrics) Import(ctx context.Context, rows []domain.ProductImportRow) (created, updated int, err error) {
+	start := time.Now()
+	created, updated, err = m.rp.Import(ctx, rows)
+	m.observe("Import", start, err)
+	return
+}
+
+func (m *ProductMetrics) UpdateById(ctx context.Context, id int, p domain.Product) (r domain.Product, err error) {
+	start := time.Now()
+	r, err = m.rp.UpdateById(ctx, id, p)
+	m.observe("UpdateById", start, err)
+	return
+}
+
+func (m *ProductMetrics) UpdateAttributesById(ctx context.Context, id int, p domain.ProductPatcher) (r domain.Product, err error) {
+	start := time.Now()
+	r, err = m.rp.UpdateAttributesById(ctx, id, p)
+	m.observe("UpdateAttributesById", start, err)
+	return
+}
+
+func (m *ProductMetrics) DeleteById(ctx context.Context, id int) (err error) {
+	start := time.Now()
+	err = m.rp.DeleteById(ctx, id)
+	m.observe("DeleteById", start, err)
+	return
+}
@@ -0,0 +1,41 @@
+package repository_test
+
+import (
+	"app/internal/domain"
+	"app/internal/metrics"
+	"app/internal/repository"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductMetrics_CountsCallsAndCatalog(t *testing.T) {
+	ctx := context.Background()
+	reg := metrics.NewRegistry()
+	rp := repository.NewProductMetrics(repository.NewProductMap(map[int]domain.Product{
+		1: {Id: 1, Name: "Milk", Quantity: 10, Price: 2.5},
+		2: {Id: 2, Name: "Bread", Quantity: 4, Price: 1.25},
+	}), reg)
+
+	_, err := rp.GetById(ctx, 1)
+	require.NoError(t, err)
+	_, err = rp.GetById(ctx, 9)
+	require.Error(t, err)
+	_, err = rp.Create(ctx, domain.Product{Name: "Eggs", Quantity: 2, Price: 3})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = reg.WriteTo(&buf)
+	require.NoError(t, err)
+	out := buf.String()
+
+	assert.Contains(t, out, `repository_operations_total{method="GetById",outcome="ok"} 1`)
+	assert.Contains(t, out, `repository_operations_total{method="GetById",outcome="error"} 1`)
+	assert.Contains(t, out, `repository_operations_total{method="Create",outcome="ok"} 1`)
+	assert.Contains(t, out, `repository_operation_duration_seconds_count{method="GetById"} 2`)
+	assert.Contains(t, out, "catalog_products 3\n")
+	assert.Contains(t, out, "catalog_stock_value 36\n")
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// accentFolds maps accented letters to their unaccented spelling, so "creme"
+// finds "Crème". Input is lower-cased before folding.
+var accentFolds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a",
+	'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ñ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u",
+	'ý': "y", 'ÿ': "y",
+	'ß': "ss", 'æ': "ae", 'œ': "oe",
+}
+
+// tokenize splits s into lower-cased, accent-folded words of letters and
+// digits.
+func tokenize(s string) []string {
+	var (
+		tokens []string
+		b      strings.Builder
+	)
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, b.String())
+			b.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(s) {
+		if fold, ok := accentFolds[r]; ok {
+			b.WriteString(fold)
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			continue
+		}
+		flush()
+	}
+	flush()
+
+	return tokens
+}
+
+// textIndex is an inverted index from name tokens to product ids. terms is
+// kept sorted so prefix lookups are a binary search followed by a short scan.
+// It is not safe for concurrent use; ProductMap guards it with its own lock.
+type textIndex struct {
+	postings map[string]map[int]struct{}
+	terms    []string
+	docs     map[int][]string
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		postings: make(map[string]map[int]struct{}),
+		docs:     make(map[int][]string),
+	}
+}
+
+func (ix *textIndex) add(id int, text string) {
+	ix.remove(id)
+
+	tokens := tokenize(text)
+	ix.docs[id] = tokens
+	for _, t := range tokens {
+		ids, ok := ix.postings[t]
+		if !ok {
+			ids = make(map[int]struct{})
+			ix.postings[t] = ids
+			i := sort.SearchStrings(ix.terms, t)
+			ix.terms = append(ix.terms, "")
+			copy(ix.terms[i+1:], ix.terms[i:])
+			ix.terms[i] = t
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+func (ix *textIndex) remove(id int) {
+	for _, t := range ix.docs[id] {
+		ids := ix.postings[t]
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(ix.postings, t)
+			if i := sort.SearchStrings(ix.terms, t); i < len(ix.terms) && ix.terms[i] == t {
+				ix.terms = append(ix.terms[:i], ix.terms[i+1:]...)
+			}
+		}
+	}
+	delete(ix.docs, id)
+}
+
+// search scores every product matching at least one query token. An exact
+// token match weighs 1 and a prefix match (for typeahead) weighs the share of
+// the term the prefix covers, halved; both are scaled by the term's inverse
+// document frequency. The sum is multiplied by the fraction of query tokens
+// matched, so products matching the whole query rank first.
+func (ix *textIndex) search(q string) map[int]float64 {
+	tokens := tokenize(q)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	n := float64(len(ix.docs))
+	scores := make(map[int]float64)
+	matched := make(map[int]int)
+
+	seen := make(map[string]bool)
+	var unique int
+	for _, qt := range tokens {
+		if seen[qt] {
+			continue
+		}
+		seen[qt] = true
+		unique++
+
+		best := make(map[int]float64)
+		for i := sort.SearchStrings(ix.terms, qt); i < len(ix.terms) && strings.HasPrefix(ix.terms[i], qt); i++ {
+			term := ix.terms[i]
+			ids := ix.postings[term]
+			weight := math.Log(1 + n/float64(len(ids)))
+			if term != qt {
+				weight *= 0.5 * float64(len(qt)) / float64(len(term))
+			}
+			for id := range ids {
+				best[id] = max(best[id], weight)
+			}
+		}
+
+		for id, w := range best {
+			scores[id] += w
+			matched[id]++
+		}
+	}
+
+	for id := range scores {
+		scores[id] *= float64(matched[id]) / float64(unique)
+	}
+
+	return scores
+}
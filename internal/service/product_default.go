@@ -3,6 +3,11 @@ package service
 import (
 	"app/internal"
 	"app/internal/domain"
+	"app/internal/logging"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
 )
 
 func NewProductDefault(rp internal.ProductRepository) *ProductDefault {
@@ -13,32 +18,202 @@ type ProductDefault struct {
 	rp internal.ProductRepository
 }
 
-func (s *ProductDefault) FindAll() (map[int]domain.Product, error) {
-	return s.rp.FindAll()
+func (s *ProductDefault) FindAll(ctx context.Context) (map[int]domain.Product, error) {
+	return s.rp.FindAll(ctx)
 }
 
-func (s *ProductDefault) Create(new domain.Product) error {
-	return s.rp.Create(new)
+func (s *ProductDefault) FindPage(ctx context.Context, q domain.ProductPageQuery) ([]domain.Product, int, error) {
+	return s.rp.FindPage(ctx, q)
 }
 
-func (s *ProductDefault) GetById(id int) (domain.Product, error) {
-	return s.rp.GetById(id)
+func (s *ProductDefault) Create(ctx context.Context, new domain.Product) (domain.Product, error) {
+	if err := s.checkCodeValue(ctx, new.CodeValue, 0); err != nil {
+		return domain.Product{}, err
+	}
+
+	p, err := s.rp.Create(ctx, new)
+	if err != nil {
+		return p, err
+	}
+	logging.FromContext(ctx).Info("product created", "product_id", p.Id)
+	return p, nil
 }
 
-func (s *ProductDefault) FindProducts(price float64) (map[int]domain.Product, error) {
-	return s.rp.FindProducts(price)
+func (s *ProductDefault) GetById(ctx context.Context, id int) (domain.Product, error) {
+	return s.rp.GetById(ctx, id)
 }
 
-func (s *ProductDefault) DeleteById(id int) error {
-	return s.rp.DeleteById(id)
+func (s *ProductDefault) GetByCodeValue(ctx context.Context, code string) (domain.Product, error) {
+	return s.rp.GetByCodeValue(ctx, code)
 }
 
-func (s *ProductDefault) UpdateById(id int, p domain.Product) (domain.Product, error) {
-	return s.rp.UpdateById(id, p)
+func (s *ProductDefault) FindProducts(ctx context.Context, f domain.ProductFilter) ([]domain.Product, error) {
+	return s.rp.FindProducts(ctx, f)
 }
 
-func (s *ProductDefault) UpdateAttributesById(id int, p domain.Product) (domain.Product, error) {
-	return s.rp.UpdateAttributesById(id, p)
+func (s *ProductDefault) SearchText(ctx context.Context, q string, limit int) ([]domain.ProductMatch, error) {
+	return s.rp.SearchText(ctx, q, limit)
+}
+
+// FindExpiring returns the products that are still good on asOf but expire
+// within the given number of days, soonest first.
+func (s *ProductDefault) FindExpiring(ctx context.Context, asOf domain.Date, days int) ([]domain.Product, error) {
+	p, err := s.rp.FindByExpiration(ctx, asOf, asOf.AddDays(days+1))
+	if err != nil {
+		return nil, err
+	}
+	sortByExpiration(p)
+	return p, nil
+}
+
+// FindExpired returns the products whose expiration is before asOf, oldest
+// first.
+func (s *ProductDefault) FindExpired(ctx context.Context, asOf domain.Date) ([]domain.Product, error) {
+	p, err := s.rp.FindByExpiration(ctx, domain.Date{}, asOf)
+	if err != nil {
+		return nil, err
+	}
+	sortByExpiration(p)
+	return p, nil
+}
+
+func sortByExpiration(p []domain.Product) {
+	sort.Slice(p, func(i, j int) bool {
+		if c := p[i].Expiration.Compare(p[j].Expiration); c != 0 {
+			return c < 0
+		}
+		return p[i].Id < p[j].Id
+	})
+}
+
+func (s *ProductDefault) DeleteById(ctx context.Context, id int) error {
+	if err := s.rp.DeleteById(ctx, id); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("product deleted", "product_id", id)
+	return nil
+}
+
+func (s *ProductDefault) UpdateById(ctx context.Context, id int, p domain.Product) (domain.Product, error) {
+	if err := s.checkCodeValue(ctx, p.CodeValue, id); err != nil {
+		return domain.Product{}, err
+	}
+
+	p, err := s.rp.UpdateById(ctx, id, p)
+	if err != nil {
+		return p, err
+	}
+	logging.FromContext(ctx).Info("product updated", "product_id", id)
+	return p, nil
+}
+
+func (s *ProductDefault) UpdateAttributesById(ctx context.Context, id int, p domain.ProductPatcher) (domain.Product, error) {
+	// Other patchers only know the code value once applied; the repository
+	// rejects a duplicate then.
+	if pp, ok := p.(domain.ProductPatch); ok && pp.CodeValue != nil {
+		if err := s.checkCodeValue(ctx, *pp.CodeValue, id); err != nil {
+			return domain.Product{}, err
+		}
+	}
+
+	r, err := s.rp.UpdateAttributesById(ctx, id, p)
+	if err != nil {
+		return r, err
+	}
+	logging.FromContext(ctx).Info("product patched", "product_id", id)
+	return r, nil
+}
+
+// Import checks every row against the catalog and, unless dryRun or a row
+// failed, applies them in order. Rows are checked as if the earlier ones were
+// applied, so a file may move a code value from one product to another.
+// Applying is all or nothing: should a row fail then, after a concurrent
+// change, the error names its line and no row is imported.
+func (s *ProductDefault) Import(ctx context.Context, rows []domain.ProductImportRow, dryRun bool) (domain.ProductImportReport, error) {
+	r := domain.ProductImportReport{DryRun: dryRun, Rows: len(rows), Errors: []domain.ProductImportError{}}
+
+	db, err := s.rp.FindAll(ctx)
+	if err != nil {
+		return r, err
+	}
+
+	// codes maps each code value to its owner: a product id, or minus the
+	// line of the row creating it.
+	codes := make(map[string]int, len(db))
+	for id, p := range db {
+		if p.CodeValue != "" {
+			codes[p.CodeValue] = id
+		}
+	}
+	seen := make(map[int]int)
+	var created, updated int
+	for _, row := range rows {
+		p := row.Product
+		owner := -row.Line
+		fail := func(field, code, message string) {
+			r.Errors = append(r.Errors, domain.ProductImportError{Line: row.Line, Field: field, Code: code, Message: message})
+		}
+
+		if p.Id != 0 {
+			owner = p.Id
+			current, ok := db[p.Id]
+			if line, dup := seen[p.Id]; dup {
+				fail("id", domain.ImportCodeDuplicateId, fmt.Sprintf("Product %d is already imported on line %d.", p.Id, line))
+				continue
+			}
+			seen[p.Id] = row.Line
+			if !ok {
+				fail("id", domain.ImportCodeNotFound, fmt.Sprintf("Product %d not found.", p.Id))
+				continue
+			}
+			if codes[current.CodeValue] == p.Id {
+				delete(codes, current.CodeValue)
+			}
+		}
+
+		if p.CodeValue != "" {
+			if other, ok := codes[p.CodeValue]; ok && other != owner {
+				fail("code_value", domain.ImportCodeCodeValueExists, domain.ErrCodeValueExists.Error())
+				continue
+			}
+			codes[p.CodeValue] = owner
+		}
+
+		if p.Id != 0 {
+			updated++
+		} else {
+			created++
+		}
+	}
+
+	if dryRun || len(r.Errors) > 0 {
+		r.Created, r.Updated = created, updated
+		return r, nil
+	}
+
+	if r.Created, r.Updated, err = s.rp.Import(ctx, rows); err != nil {
+		return r, err
+	}
+	logging.FromContext(ctx).Info("products imported", "created", r.Created, "updated", r.Updated)
+	return r, nil
+}
+
+// checkCodeValue rejects code when it already belongs to a product other
+// than id.
+func (s *ProductDefault) checkCodeValue(ctx context.Context, code string, id int) error {
+	if code == "" {
+		return nil
+	}
+	existing, err := s.rp.GetByCodeValue(ctx, code)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	case existing.Id != id:
+		return domain.ErrCodeValueExists
+	}
+	return nil
 }
 
 // func (s *ProductDefault) FindByColorAndYear(vehicle domain.Product) (v map[int]domain.Product, err error) {
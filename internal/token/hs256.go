@@ -0,0 +1,255 @@
+// Package token issues and verifies HS256 JSON Web Tokens (RFC 7519) with the
+// standard library only.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed    = errors.New("token is malformed")
+	ErrAlgorithm    = errors.New("token algorithm is not HS256")
+	ErrSignature    = errors.New("token signature is invalid")
+	ErrExpired      = errors.New("token is expired")
+	ErrNotYetValid  = errors.New("token is not valid yet")
+	ErrIssuer       = errors.New("token issuer is not accepted")
+	ErrAudience     = errors.New("token audience is not accepted")
+	ErrMissingClaim = errors.New("token lacks a required claim")
+)
+
+// MinSecretLength is the shortest secret accepted; RFC 7518 requires a key at
+// least as long as the hash output.
+const MinSecretLength = sha256.Size
+
+// Claims are the registered claims this API uses plus the role granted to
+// the subject. Times are in seconds since the epoch.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Role      string   `json:"role,omitempty"`
+}
+
+// Audience is the aud claim, which RFC 7519 allows to be a single string or
+// an array of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*a = l
+	return nil
+}
+
+func (a Audience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type ConfigHS256 struct {
+	// Secret signs and verifies tokens; at least MinSecretLength bytes.
+	Secret []byte
+	// Issuer and Audience are written into minted tokens and required of
+	// verified ones.
+	Issuer   string
+	Audience string
+	// TTL is the lifetime of minted tokens and MaxTTL caps what callers of
+	// Mint may ask for.
+	TTL    time.Duration
+	MaxTTL time.Duration
+	// Leeway tolerates clock skew between the issuer and this server when
+	// checking exp and nbf; a negative value tolerates none.
+	Leeway time.Duration
+	// Now is the clock, time.Now by default.
+	Now func() time.Time
+}
+
+func NewHS256(cfg *ConfigHS256) (*HS256, error) {
+	defaultConfig := &ConfigHS256{
+		Issuer:   "products-api",
+		Audience: "products-api",
+		TTL:      15 * time.Minute,
+		MaxTTL:   24 * time.Hour,
+		Leeway:   30 * time.Second,
+		Now:      time.Now,
+	}
+	if cfg != nil {
+		defaultConfig.Secret = cfg.Secret
+		if cfg.Issuer != "" {
+			defaultConfig.Issuer = cfg.Issuer
+		}
+		if cfg.Audience != "" {
+			defaultConfig.Audience = cfg.Audience
+		}
+		if cfg.TTL > 0 {
+			defaultConfig.TTL = cfg.TTL
+		}
+		if cfg.MaxTTL > 0 {
+			defaultConfig.MaxTTL = cfg.MaxTTL
+		}
+		if cfg.Leeway != 0 {
+			defaultConfig.Leeway = max(cfg.Leeway, 0)
+		}
+		if cfg.Now != nil {
+			defaultConfig.Now = cfg.Now
+		}
+	}
+	if len(defaultConfig.Secret) < MinSecretLength {
+		return nil, fmt.Errorf("token secret must be at least %d bytes", MinSecretLength)
+	}
+	if defaultConfig.TTL > defaultConfig.MaxTTL {
+		defaultConfig.MaxTTL = defaultConfig.TTL
+	}
+
+	return &HS256{
+		secret:   defaultConfig.Secret,
+		issuer:   defaultConfig.Issuer,
+		audience: defaultConfig.Audience,
+		ttl:      defaultConfig.TTL,
+		maxTTL:   defaultConfig.MaxTTL,
+		leeway:   defaultConfig.Leeway,
+		now:      defaultConfig.Now,
+	}, nil
+}
+
+// HS256 mints and verifies tokens signed with a shared secret.
+type HS256 struct {
+	secret   []byte
+	issuer   string
+	audience string
+	ttl      time.Duration
+	maxTTL   time.Duration
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+// Mint issues a token for subject with the given role, valid from now for
+// ttl, or the configured TTL when ttl is zero.
+func (h *HS256) Mint(subject, role string, ttl time.Duration) (token string, c Claims, err error) {
+	if subject == "" {
+		return "", c, fmt.Errorf("%w: sub", ErrMissingClaim)
+	}
+	if ttl <= 0 {
+		ttl = h.ttl
+	}
+	if ttl > h.maxTTL {
+		return "", c, fmt.Errorf("token lifetime %s exceeds %s", ttl, h.maxTTL)
+	}
+
+	now := h.now()
+	c = Claims{
+		Issuer:    h.issuer,
+		Subject:   subject,
+		Audience:  Audience{h.audience},
+		ExpiresAt: now.Add(ttl).Unix(),
+		NotBefore: now.Unix(),
+		IssuedAt:  now.Unix(),
+		Role:      role,
+	}
+
+	token, err = h.Sign(c)
+	return
+}
+
+// Sign encodes and signs c as is.
+func (h *HS256) Sign(c Claims) (string, error) {
+	hb, err := json.Marshal(header{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	cb, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(cb)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(h.sign(signed)), nil
+}
+
+// Verify checks the signature of token and its exp, nbf, iss and aud claims,
+// and returns its claims. exp is mandatory: tokens never live forever.
+func (h *HS256) Verify(token string) (c Claims, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return c, ErrMalformed
+	}
+
+	hb, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	var hd header
+	if err = json.Unmarshal(hb, &hd); err != nil {
+		return c, ErrMalformed
+	}
+	// Checking alg before the signature rules out "none" and algorithm
+	// confusion attacks.
+	if hd.Alg != "HS256" {
+		return c, ErrAlgorithm
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	if !hmac.Equal(sig, h.sign(parts[0]+"."+parts[1])) {
+		return c, ErrSignature
+	}
+
+	cb, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	if err = json.Unmarshal(cb, &c); err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	now := h.now()
+	switch {
+	case c.ExpiresAt == 0:
+		return Claims{}, fmt.Errorf("%w: exp", ErrMissingClaim)
+	case !now.Before(time.Unix(c.ExpiresAt, 0).Add(h.leeway)):
+		return Claims{}, ErrExpired
+	case c.NotBefore != 0 && now.Add(h.leeway).Before(time.Unix(c.NotBefore, 0)):
+		return Claims{}, ErrNotYetValid
+	case c.Issuer != h.issuer:
+		return Claims{}, ErrIssuer
+	case !c.Audience.contains(h.audience):
+		return Claims{}, ErrAudience
+	}
+
+	return c, nil
+}
+
+func (h *HS256) sign(s string) []byte {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,158 @@
+package token_test
+
+import (
+	"app/internal/token"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestHS256(t *testing.T, now *time.Time) *token.HS256 {
+	t.Helper()
+
+	h, err := token.NewHS256(&token.ConfigHS256{
+		Secret: secret,
+		TTL:    10 * time.Minute,
+		MaxTTL: time.Hour,
+		Leeway: 30 * time.Second,
+		Now:    func() time.Time { return *now },
+	})
+	require.NoError(t, err)
+	return h
+}
+
+func TestHS256_MintAndVerify(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h := newTestHS256(t, &now)
+
+	tk, claims, err := h.Mint("pos-7", "editor", 0)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(10*time.Minute).Unix(), claims.ExpiresAt)
+
+	got, err := h.Verify(tk)
+	require.NoError(t, err)
+	assert.Equal(t, claims, got)
+
+	// Within the leeway on both sides of the validity window.
+	now = now.Add(-20 * time.Second)
+	_, err = h.Verify(tk)
+	assert.NoError(t, err)
+	now = now.Add(10*time.Minute + 40*time.Second)
+	_, err = h.Verify(tk)
+	assert.NoError(t, err)
+
+	now = now.Add(10 * time.Second)
+	_, err = h.Verify(tk)
+	assert.ErrorIs(t, err, token.ErrExpired)
+}
+
+func TestHS256_NegativeLeewayToleratesNoSkew(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h, err := token.NewHS256(&token.ConfigHS256{
+		Secret: secret,
+		Leeway: -1,
+		Now:    func() time.Time { return now },
+	})
+	require.NoError(t, err)
+
+	tk, claims, err := h.Mint("pos-7", "editor", time.Minute)
+	require.NoError(t, err)
+
+	now = time.Unix(claims.ExpiresAt, 0).Add(-time.Second)
+	_, err = h.Verify(tk)
+	assert.NoError(t, err)
+	now = now.Add(time.Second)
+	_, err = h.Verify(tk)
+	assert.ErrorIs(t, err, token.ErrExpired)
+}
+
+func TestHS256_Verify_Rejects(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h := newTestHS256(t, &now)
+	valid := token.Claims{
+		Issuer:    "products-api",
+		Subject:   "pos-7",
+		Audience:  token.Audience{"products-api"},
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		Role:      "reader",
+	}
+
+	sign := func(c token.Claims) string {
+		tk, err := h.Sign(c)
+		require.NoError(t, err)
+		return tk
+	}
+	with := func(f func(*token.Claims)) string {
+		c := valid
+		f(&c)
+		return sign(c)
+	}
+	good := sign(valid)
+	parts := strings.Split(good, ".")
+
+	other, err := token.NewHS256(&token.ConfigHS256{Secret: []byte(strings.Repeat("x", 32))})
+	require.NoError(t, err)
+	forged, err := other.Sign(valid)
+	require.NoError(t, err)
+
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(noneHeader + "." + parts[1]))
+	algNone := noneHeader + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := map[string]struct {
+		token string
+		err   error
+	}{
+		"two segments":    {parts[0] + "." + parts[1], token.ErrMalformed},
+		"garbage":         {"a.b.c", token.ErrMalformed},
+		"alg none":        {algNone, token.ErrAlgorithm},
+		"other secret":    {forged, token.ErrSignature},
+		"tampered claims": {parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"pos-8"}`)) + "." + parts[2], token.ErrSignature},
+		"no exp":          {with(func(c *token.Claims) { c.ExpiresAt = 0 }), token.ErrMissingClaim},
+		"expired":         {with(func(c *token.Claims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }), token.ErrExpired},
+		"not yet valid":   {with(func(c *token.Claims) { c.NotBefore = now.Add(time.Minute).Unix() }), token.ErrNotYetValid},
+		"issuer":          {with(func(c *token.Claims) { c.Issuer = "someone-else" }), token.ErrIssuer},
+		"audience":        {with(func(c *token.Claims) { c.Audience = token.Audience{"billing"} }), token.ErrAudience},
+	}
+	for name, tt := range tests {
+		_, err := h.Verify(tt.token)
+		assert.ErrorIs(t, err, tt.err, name)
+	}
+}
+
+func TestHS256_Verify_AudienceAsString(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h := newTestHS256(t, &now)
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"products-api","sub":"pos-1","aud":"products-api","exp":1714565400}`))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(header + "." + claims))
+
+	c, err := h.Verify(header + "." + claims + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, token.Audience{"products-api"}, c.Audience)
+}
+
+func TestHS256_Mint_Limits(t *testing.T) {
+	now := time.Now()
+	h := newTestHS256(t, &now)
+
+	_, _, err := h.Mint("", "reader", 0)
+	assert.ErrorIs(t, err, token.ErrMissingClaim)
+
+	_, _, err = h.Mint("pos-1", "reader", 2*time.Hour)
+	assert.Error(t, err)
+
+	_, err = token.NewHS256(&token.ConfigHS256{Secret: []byte("short")})
+	assert.Error(t, err)
+}